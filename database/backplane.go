@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Channel used to share websocket messages between instances
+const BackplaneChannel string = "websocket_hub"
+
+// Websocket backplane using Postgres LISTEN/NOTIFY, notification payload must be smaller than 8000 bytes
+type PostgresBackplane struct {
+	db       *sql.DB      // Connection to send notifications
+	listener *pq.Listener // Dedicated connection to receive notifications
+	channel  string       // Channel to listen and notify
+}
+
+// Create a backplane using the same database of the repository
+func (repo *PostgresRepository) NewBackplane(channel string) (*PostgresBackplane, error) {
+	// Listener reconnects by itself if the connection is lost
+	listener := pq.NewListener(repo.url, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println("Backplane listener error", err)
+		}
+	})
+	if err := listener.Listen(channel); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return &PostgresBackplane{
+		db:       repo.db,
+		listener: listener,
+		channel:  channel,
+	}, nil
+}
+
+// Send data to every instance listening the channel
+func (backplane *PostgresBackplane) Publish(ctx context.Context, data []byte) error {
+	_, err := backplane.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", backplane.channel, string(data))
+	return err
+}
+
+// Call handler with every notification received on the channel
+func (backplane *PostgresBackplane) Subscribe(handler func(data []byte)) error {
+	go func() {
+		for notification := range backplane.listener.Notify {
+			if notification == nil {
+				continue // Connection was re-established, notifications sent meanwhile are lost
+			}
+			handler([]byte(notification.Extra))
+		}
+	}()
+	return nil
+}
+
+// Close listener connection, database connection is closed by the repository
+func (backplane *PostgresBackplane) Close() error {
+	return backplane.listener.Close()
+}
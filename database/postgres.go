@@ -11,7 +11,8 @@ import (
 
 // This repository will be work as a concrete implementation of user repository
 type PostgresRepository struct {
-	db *sql.DB
+	db  *sql.DB
+	url string // Connection URL, used to open dedicated connections like listeners
 }
 
 // Constructor
@@ -20,7 +21,7 @@ func NewPostgresRepository(url string) (*PostgresRepository, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &PostgresRepository{db}, nil
+	return &PostgresRepository{db, url}, nil
 }
 
 // Implement User repository
@@ -124,19 +125,25 @@ func (repo *PostgresRepository) GetPostById(ctx context.Context, id string) (*mo
 }
 
 // Implement User repository
-func (repo *PostgresRepository) UpdatePost(ctx context.Context, post *models.Post) error {
+func (repo *PostgresRepository) UpdatePost(ctx context.Context, post *models.Post) (int64, error) {
 	// Query context return update status
-	_, err := repo.db.ExecContext(ctx, "UPDATE user_posts SET content = $1 WHERE id = $2 AND user_id = $3", post.Content, post.Id, post.UserId)
+	result, err := repo.db.ExecContext(ctx, "UPDATE user_posts SET content = $1 WHERE id = $2 AND user_id = $3", post.Content, post.Id, post.UserId)
+	if err != nil {
+		return 0, err
+	}
 
-	return err
+	return result.RowsAffected() // Zero if post does not exist or belongs to another user
 }
 
 // Implement User repository
-func (repo *PostgresRepository) DeletePost(ctx context.Context, id string, userId string) error {
+func (repo *PostgresRepository) DeletePost(ctx context.Context, id string, userId string) (int64, error) {
 	// Query context return update status
-	_, err := repo.db.ExecContext(ctx, "DELETE FROM user_posts WHERE id = $1 AND user_id = $2", id, userId)
+	result, err := repo.db.ExecContext(ctx, "DELETE FROM user_posts WHERE id = $1 AND user_id = $2", id, userId)
+	if err != nil {
+		return 0, err
+	}
 
-	return err
+	return result.RowsAffected() // Zero if post does not exist or belongs to another user
 }
 
 // Implement User repository
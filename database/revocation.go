@@ -0,0 +1,42 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"hajduksanchez.com/go/rest-websockets/models"
+	"hajduksanchez.com/go/rest-websockets/revocation"
+)
+
+// Store of revoked tokens shared by every instance through the database
+type PostgresRevocationStore struct {
+	db *sql.DB
+}
+
+// Create a revocation store using the connection of the repository
+func (repo *PostgresRepository) NewRevocationStore() *PostgresRevocationStore {
+	return &PostgresRevocationStore{repo.db}
+}
+
+func (store *PostgresRevocationStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	// Forget tokens that can not be used anymore
+	if _, err := store.db.ExecContext(ctx, "DELETE FROM revoked_tokens WHERE expires_at < NOW()"); err != nil {
+		return err
+	}
+	_, err := store.db.ExecContext(ctx, "INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING", jti, expiresAt)
+	return err
+}
+
+func (store *PostgresRevocationStore) RevokeUser(ctx context.Context, userId string, before time.Time) error {
+	_, err := store.db.ExecContext(ctx, "INSERT INTO user_revocations (user_id, revoked_before) VALUES ($1, $2) ON CONFLICT (user_id) DO UPDATE SET revoked_before = EXCLUDED.revoked_before", userId, before)
+	return err
+}
+
+func (store *PostgresRevocationStore) IsRevoked(ctx context.Context, claims *models.AppClaims) (bool, error) {
+	var revoked bool
+	// Same rule as revocation.IssuedBefore
+	err := store.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1) OR EXISTS (SELECT 1 FROM user_revocations WHERE user_id = $2 AND revoked_before >= $3)",
+		claims.Id, claims.UserId, revocation.IssuedAt(claims)).Scan(&revoked)
+	return revoked, err
+}
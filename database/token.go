@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"log"
+
+	"hajduksanchez.com/go/rest-websockets/models"
+)
+
+// Implement User repository
+func (repo *PostgresRepository) InsertRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	_, err := repo.db.ExecContext(ctx, "INSERT INTO refresh_tokens (id, family_id, user_id, token_hash, expires_at) VALUES ($1, $2, $3, $4, $5)",
+		token.Id, token.FamilyId, token.UserId, token.TokenHash, token.ExpiresAt)
+	return err
+}
+
+// Implement User repository
+func (repo *PostgresRepository) GetRefreshTokenByHash(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	// Query context return rows of data
+	rows, err := repo.db.QueryContext(ctx, "SELECT id, family_id, user_id, token_hash, expires_at, used_at, revoked_at, created_at FROM refresh_tokens WHERE token_hash = $1", hash)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close() // Close database connection
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	var token = models.RefreshToken{}
+	for rows.Next() {
+		// Try to map values from rows into model
+		if err := rows.Scan(&token.Id, &token.FamilyId, &token.UserId, &token.TokenHash, &token.ExpiresAt, &token.UsedAt, &token.RevokedAt, &token.CreatedAt); err == nil {
+			return &token, nil // Everything ok
+		}
+	}
+
+	// If there is some error getting data from database
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// Implement User repository
+func (repo *PostgresRepository) UseRefreshToken(ctx context.Context, id string) (int64, error) {
+	// Only one request can use the token, even if they arrive at the same time
+	result, err := repo.db.ExecContext(ctx, "UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1 AND used_at IS NULL AND revoked_at IS NULL", id)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected() // Zero if token was already used or revoked
+}
+
+// Implement User repository
+func (repo *PostgresRepository) RevokeRefreshTokenFamily(ctx context.Context, familyId string) error {
+	_, err := repo.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL", familyId)
+	return err
+}
+
+// Implement User repository
+func (repo *PostgresRepository) RevokeUserRefreshTokens(ctx context.Context, userId string) error {
+	_, err := repo.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", userId)
+	return err
+}
@@ -15,4 +15,35 @@ CREATE TABLE user_posts (
 	content VARCHAR(32) NOT NULL,
 	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
 	FOREIGN KEY (user_id) REFERENCES users(id)
-);
\ No newline at end of file
+);
+
+DROP TABLE IF EXISTS refresh_tokens;
+
+CREATE TABLE refresh_tokens (
+	id VARCHAR(32) PRIMARY KEY,
+	family_id VARCHAR(32) NOT NULL,
+	user_id VARCHAR(32) NOT NULL,
+	token_hash VARCHAR(64) NOT NULL UNIQUE,
+	expires_at TIMESTAMPTZ NOT NULL,
+	used_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX refresh_tokens_family_id ON refresh_tokens (family_id);
+
+DROP TABLE IF EXISTS revoked_tokens;
+
+CREATE TABLE revoked_tokens (
+	jti VARCHAR(32) PRIMARY KEY,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+
+DROP TABLE IF EXISTS user_revocations;
+
+CREATE TABLE user_revocations (
+	user_id VARCHAR(32) PRIMARY KEY,
+	revoked_before TIMESTAMPTZ NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
@@ -3,11 +3,18 @@ module hajduksanchez.com/go/rest-websockets
 go 1.19
 
 require (
+	github.com/fxamacker/cbor/v2 v2.7.0
 	github.com/golang-jwt/jwt v3.2.2+incompatible
 	github.com/gorilla/mux v1.8.0
 	github.com/gorilla/websocket v1.5.0
 	github.com/joho/godotenv v1.5.0
 	github.com/lib/pq v1.10.7
 	github.com/segmentio/ksuid v1.0.4
+	github.com/vmihailenco/msgpack/v5 v5.4.1
 	golang.org/x/crypto v0.5.0
 )
+
+require (
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+)
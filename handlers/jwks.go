@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"hajduksanchez.com/go/rest-websockets/keys"
+	"hajduksanchez.com/go/rest-websockets/server"
+)
+
+// Handler to publish the public keys that verify tokens, so other services do not need the secret
+func JWKSHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Keys are published at least this long before signing with them, see the activation delay of the server
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(keys.JWKSMaxAge.Seconds())))
+		json.NewEncoder(w).Encode(s.Keys().JWKS())
+	}
+}
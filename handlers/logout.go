@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"hajduksanchez.com/go/rest-websockets/repository"
+	"hajduksanchez.com/go/rest-websockets/server"
+	"hajduksanchez.com/go/rest-websockets/utils"
+)
+
+type LogoutResponse struct {
+	Message string `json:"message"`
+}
+
+// Revoke the access token used on the request. The refresh token of the session can be sent on the
+// body like on refresh, so it is revoked too
+func LogoutHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := utils.ClaimsFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		// Body is optional
+		var request = RefreshTokenRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Tokens issued before they had an id can not be revoked one by one, they just expire
+		if claims.Id != "" {
+			if err := s.Revocations().Revoke(r.Context(), claims.Id, time.Unix(claims.ExpiresAt, 0)); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			s.Hub().Disconnect(claims.UserId, claims.Id) // Connections opened with the token on every instance
+		}
+
+		if request.RefreshToken != "" {
+			token, err := repository.GetRefreshTokenByHash(r.Context(), hashRefreshToken(request.RefreshToken))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			// Nobody can log out sessions of other users
+			if token.Id != "" && token.UserId == claims.UserId {
+				if err := repository.RevokeRefreshTokenFamily(r.Context(), token.FamilyId); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(LogoutResponse{
+			Message: "Logged out successfully",
+		})
+	}
+}
+
+// Revoke every access token and refresh token of the user, closing his sessions on every device
+func LogoutAllHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := utils.ClaimsFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		if err := s.Revocations().RevokeUser(r.Context(), claims.UserId, time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := repository.RevokeUserRefreshTokens(r.Context(), claims.UserId); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.Hub().Disconnect(claims.UserId, "") // Every connection of the user on every instance
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(LogoutResponse{
+			Message: "Logged out from every session successfully",
+		})
+	}
+}
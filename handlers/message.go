@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"hajduksanchez.com/go/rest-websockets/models"
+	"hajduksanchez.com/go/rest-websockets/server"
+	"hajduksanchez.com/go/rest-websockets/utils"
+)
+
+// Type of the messages users send to each other, the type they choose goes inside the payload
+const UserMessageType string = "User-Message"
+
+type UserMessageResponse struct {
+	Delivered int `json:"delivered"` // Number of open connections of the user that received the message
+}
+
+// Handler to send a message to every websocket connection of a user
+func SendUserMessageHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r) // Get Path parameters to get ID of user like 'users/:ID/messages'
+		// Only authenticated users can send messages
+		claims, err := utils.ClaimsFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var message = models.WebsocketMessage{}
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if message.Type == "" {
+			http.Error(w, "message type is required", http.StatusBadRequest)
+			return
+		}
+
+		// Receivers know who sent it and can not mistake it for an event of the server
+		delivered := s.Hub().SendToUser(params["id"], models.WebsocketMessage{
+			Type: UserMessageType,
+			Payload: models.UserMessage{
+				SenderId: claims.UserId,
+				Type:     message.Type,
+				Payload:  message.Payload,
+			},
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(UserMessageResponse{
+			Delivered: delivered,
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -11,6 +13,7 @@ import (
 	"hajduksanchez.com/go/rest-websockets/repository"
 	"hajduksanchez.com/go/rest-websockets/server"
 	"hajduksanchez.com/go/rest-websockets/utils"
+	"hajduksanchez.com/go/rest-websockets/websocket"
 )
 
 // Struct to insert or update post
@@ -27,11 +30,14 @@ type PostUpdateResponse struct {
 	Message string `json:"message"`
 }
 
+// Post does not exist or belongs to another user
+var errPostNotFound = errors.New("Post not found")
+
 // Handler to insert a new post into DB
 func InsertPostHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		claims, err := utils.ValidateAuthorizationToken(s, w, r)
-		// Try to get data from Token validating if token is valid
+		// Claims of the token the auth middleware validated
+		claims, err := utils.ClaimsFromRequest(r)
 		if err == nil {
 			var postRequest = UpsertPostRequest{}
 			if err := json.NewDecoder(r.Body).Decode(&postRequest); err != nil {
@@ -39,32 +45,13 @@ func InsertPostHandler(s server.Server) http.HandlerFunc {
 				return
 			}
 
-			// Generate new ID
-			id, err := ksuid.NewRandom()
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			// Create post Model
-			post := models.Post{
-				Id:      id.String(),
-				Content: postRequest.PostContent,
-				UserId:  claims.UserId,
-			}
 			// Insert post
-			err = repository.InsertPost(r.Context(), &post)
+			post, err := createPost(r.Context(), s, claims.UserId, postRequest.PostContent)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
 
-			var postMessage = models.WebsocketMessage{
-				Type:    "Post-Created",
-				Payload: post,
-			}
-			s.Hub().Broadcast(postMessage, nil) // Send new broadcast message
-
 			// Send response
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(PostResponse{
@@ -72,8 +59,8 @@ func InsertPostHandler(s server.Server) http.HandlerFunc {
 				PostContent: post.Content,
 			})
 		} else {
-			// Error with Token
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			// Request was not authenticated
+			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
 	}
@@ -97,8 +84,8 @@ func GetPostById(s server.Server) http.HandlerFunc {
 func UpdatePostHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		params := mux.Vars(r) // Get Path parameters to get ID of post like 'post/:ID'
-		claims, err := utils.ValidateAuthorizationToken(s, w, r)
-		// Try to get data from Token validating if token is valid
+		// Claims of the token the auth middleware validated
+		claims, err := utils.ClaimsFromRequest(r)
 		if err == nil {
 			var postRequest = UpsertPostRequest{}
 			if err := json.NewDecoder(r.Body).Decode(&postRequest); err != nil {
@@ -114,7 +101,11 @@ func UpdatePostHandler(s server.Server) http.HandlerFunc {
 			}
 
 			// Update post
-			err = repository.UpdatePost(r.Context(), &post)
+			_, err = updatePost(r.Context(), s, &post)
+			if errors.Is(err, errPostNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -126,8 +117,8 @@ func UpdatePostHandler(s server.Server) http.HandlerFunc {
 				Message: "Post updated successfully",
 			})
 		} else {
-			// Error with Token
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			// Request was not authenticated
+			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
 	}
@@ -137,12 +128,16 @@ func UpdatePostHandler(s server.Server) http.HandlerFunc {
 func DeletePostHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		params := mux.Vars(r) // Get Path parameters to get ID of post like 'post/:ID'
-		claims, err := utils.ValidateAuthorizationToken(s, w, r)
-		// Try to get data from Token validating if token is valid
+		// Claims of the token the auth middleware validated
+		claims, err := utils.ClaimsFromRequest(r)
 		if err == nil {
 
 			// Delete post
-			err = repository.DeletePost(r.Context(), params["id"], claims.UserId)
+			err = deletePost(r.Context(), s, params["id"], claims.UserId)
+			if errors.Is(err, errPostNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -154,8 +149,8 @@ func DeletePostHandler(s server.Server) http.HandlerFunc {
 				Message: "Post deleted successfully",
 			})
 		} else {
-			// Error with Token
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			// Request was not authenticated
+			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
 	}
@@ -189,3 +184,71 @@ func ListPostHandler(s server.Server) http.HandlerFunc {
 		}
 	}
 }
+
+// Insert a new post of the user and notify clients listening posts
+func createPost(ctx context.Context, s server.Server, userId string, content string) (*models.Post, error) {
+	// Generate new ID
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	// Create post Model
+	post := models.Post{
+		Id:      id.String(),
+		Content: content,
+		UserId:  userId,
+	}
+	if err := repository.InsertPost(ctx, &post); err != nil {
+		return nil, err
+	}
+
+	var postMessage = models.WebsocketMessage{
+		Type:    "Post-Created",
+		Payload: post,
+	}
+	s.Hub().Publish(websocket.PostsTopic, postMessage) // Send message to clients listening posts
+	return &post, nil
+}
+
+// Update content of a post of the user and notify clients listening posts
+func updatePost(ctx context.Context, s server.Server, post *models.Post) (*models.Post, error) {
+	updated, err := repository.UpdatePost(ctx, post)
+	if err != nil {
+		return nil, err
+	}
+	if updated == 0 {
+		return nil, errPostNotFound // Post does not exist or belongs to another user
+	}
+
+	// Get full post to notify clients, like creation date
+	updatedPost, err := repository.GetPostById(ctx, post.Id)
+	if err != nil {
+		return nil, err
+	}
+	s.Hub().Publish(websocket.PostsTopic, models.WebsocketMessage{
+		Type:    "Post-Updated",
+		Payload: updatedPost,
+	})
+	return updatedPost, nil
+}
+
+// Delete post of the user and notify clients listening posts
+func deletePost(ctx context.Context, s server.Server, id string, userId string) error {
+	deleted, err := repository.DeletePost(ctx, id, userId)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return errPostNotFound // Post does not exist or belongs to another user
+	}
+
+	s.Hub().Publish(websocket.PostsTopic, models.WebsocketMessage{
+		Type: "Post-Deleted",
+		Payload: models.DeletedPost{
+			Id:     id,
+			UserId: userId,
+		},
+	})
+	return nil
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"hajduksanchez.com/go/rest-websockets/server"
+	"hajduksanchez.com/go/rest-websockets/utils"
+)
+
+type PresenceResponse struct {
+	Users []string `json:"users"` // Ids of the users connected to the instance that answered
+}
+
+// Handler to get users connected through websocket to this instance. Behind a load balancer with several
+// instances each one only knows his own users
+func PresenceHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := utils.ClaimsFromRequest(r); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(PresenceResponse{
+			Users: s.Hub().OnlineUsers(),
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"hajduksanchez.com/go/rest-websockets/models"
+	"hajduksanchez.com/go/rest-websockets/repository"
+	"hajduksanchez.com/go/rest-websockets/server"
+	"hajduksanchez.com/go/rest-websockets/websocket"
+)
+
+// Params of methods working with a single post
+type PostIdParams struct {
+	Id string `json:"id"`
+}
+
+// Params of 'post.list'
+type PostListParams struct {
+	Page uint64 `json:"page"`
+}
+
+// Params of 'post.update'
+type PostUpdateParams struct {
+	Id          string `json:"id"`
+	PostContent string `json:"post_content"`
+}
+
+// Register methods clients can call over the websocket connection
+func RegisterRPCMethods(s server.Server) {
+	hub := s.Hub()
+	hub.HandleRPC("post.get", getPostRPC)
+	hub.HandleRPC("post.list", listPostRPC)
+	hub.HandleRPC("post.create", createPostRPC(s))
+	hub.HandleRPC("post.update", updatePostRPC(s))
+	hub.HandleRPC("post.delete", deletePostRPC(s))
+}
+
+// Get a specific post
+func getPostRPC(ctx context.Context, client *websocket.Client, params json.RawMessage) (interface{}, *models.RPCError) {
+	var request PostIdParams
+	if err := decodeParams(params, &request); err != nil || request.Id == "" {
+		return nil, websocket.NewRPCError(websocket.RPCInvalidParams, "invalid params")
+	}
+
+	post, err := repository.GetPostById(ctx, request.Id)
+	if err != nil {
+		return nil, websocket.NewRPCError(websocket.RPCInternalError, err.Error())
+	}
+	if post.Id == "" {
+		return nil, websocket.NewRPCError(websocket.RPCNotFound, errPostNotFound.Error())
+	}
+	return post, nil
+}
+
+// Get a list of post by page
+func listPostRPC(ctx context.Context, client *websocket.Client, params json.RawMessage) (interface{}, *models.RPCError) {
+	var request PostListParams
+	if err := decodeParams(params, &request); err != nil {
+		return nil, websocket.NewRPCError(websocket.RPCInvalidParams, "invalid params")
+	}
+
+	posts, err := repository.ListPost(ctx, request.Page)
+	if err != nil {
+		return nil, websocket.NewRPCError(websocket.RPCInternalError, err.Error())
+	}
+	return posts, nil
+}
+
+// Create a post of the user who opened the connection
+func createPostRPC(s server.Server) websocket.RPCMethod {
+	return func(ctx context.Context, client *websocket.Client, params json.RawMessage) (interface{}, *models.RPCError) {
+		var request UpsertPostRequest
+		if err := decodeParams(params, &request); err != nil {
+			return nil, websocket.NewRPCError(websocket.RPCInvalidParams, "invalid params")
+		}
+
+		post, err := createPost(ctx, s, client.UserId(), request.PostContent)
+		if err != nil {
+			return nil, websocket.NewRPCError(websocket.RPCInternalError, err.Error())
+		}
+		return PostResponse{Id: post.Id, PostContent: post.Content}, nil
+	}
+}
+
+// Update a post of the user who opened the connection
+func updatePostRPC(s server.Server) websocket.RPCMethod {
+	return func(ctx context.Context, client *websocket.Client, params json.RawMessage) (interface{}, *models.RPCError) {
+		var request PostUpdateParams
+		if err := decodeParams(params, &request); err != nil || request.Id == "" {
+			return nil, websocket.NewRPCError(websocket.RPCInvalidParams, "invalid params")
+		}
+
+		post, err := updatePost(ctx, s, &models.Post{
+			Id:      request.Id,
+			Content: request.PostContent,
+			UserId:  client.UserId(),
+		})
+		if err != nil {
+			return nil, postRPCError(err)
+		}
+		return post, nil
+	}
+}
+
+// Delete a post of the user who opened the connection
+func deletePostRPC(s server.Server) websocket.RPCMethod {
+	return func(ctx context.Context, client *websocket.Client, params json.RawMessage) (interface{}, *models.RPCError) {
+		var request PostIdParams
+		if err := decodeParams(params, &request); err != nil || request.Id == "" {
+			return nil, websocket.NewRPCError(websocket.RPCInvalidParams, "invalid params")
+		}
+
+		if err := deletePost(ctx, s, request.Id, client.UserId()); err != nil {
+			return nil, postRPCError(err)
+		}
+		return PostUpdateResponse{Message: "Post deleted successfully"}, nil
+	}
+}
+
+// Decode params of a method, they are optional so empty params are valid
+func decodeParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 || string(params) == "null" {
+		return nil
+	}
+	return json.Unmarshal(params, v)
+}
+
+// Error to return when working with a post fails
+func postRPCError(err error) *models.RPCError {
+	if errors.Is(err, errPostNotFound) {
+		return websocket.NewRPCError(websocket.RPCNotFound, err.Error())
+	}
+	return websocket.NewRPCError(websocket.RPCInternalError, err.Error())
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/segmentio/ksuid"
+	"hajduksanchez.com/go/rest-websockets/models"
+	"hajduksanchez.com/go/rest-websockets/repository"
+	"hajduksanchez.com/go/rest-websockets/server"
+)
+
+// Random bytes of each refresh token
+const REFRESH_TOKEN_SIZE int = 32
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Exchange a refresh token for a new access token and a new refresh token. Each refresh token can be used
+// only once, using it again means it was stolen so every token of his family is revoked
+func RefreshTokenHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request = RefreshTokenRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.RefreshToken == "" {
+			http.Error(w, "Invalid refresh token request", http.StatusBadRequest)
+			return
+		}
+
+		token, err := repository.GetRefreshTokenByHash(r.Context(), hashRefreshToken(request.RefreshToken))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if token.Id == "" || token.RevokedAt != nil || time.Now().After(token.ExpiresAt) {
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized) // Token not found, revoked or expired
+			return
+		}
+
+		// Token already exchanged, or exchanged right now by another request
+		used := int64(0)
+		if token.UsedAt == nil {
+			used, err = repository.UseRefreshToken(r.Context(), token.Id)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		if used == 0 {
+			log.Println("Refresh token reused, revoking family", token.FamilyId, "of user", token.UserId)
+			if err := repository.RevokeRefreshTokenFamily(r.Context(), token.FamilyId); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+
+		response, err := issueTokens(r.Context(), s, token.UserId, token.FamilyId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// Create access token and refresh token of the family specified, starting a new family if it is empty
+func issueTokens(ctx context.Context, s server.Server, userId string, familyId string) (*LoginResponse, error) {
+	accessToken, err := newAccessToken(s, userId)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := newRefreshToken(ctx, s, userId, familyId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.Config().AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// Sign a short lived JWT token for the user
+func newAccessToken(s server.Server, userId string) (string, error) {
+	// Unique id to revoke this specific token
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := models.AppClaims{
+		UserId: userId,
+		StandardClaims: jwt.StandardClaims{
+			Id:        id.String(),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(s.Config().AccessTokenTTL).Unix(), // Set token expires time
+		},
+		IssuedAtMs: now.UnixMilli(), // To revoke every token issued before logging out everywhere, but not the ones issued right after
+	}
+	return s.Keys().Sign(claims) // Generate token with the current key
+}
+
+// Create and store a random refresh token, only his hash is stored so a database leak does not leak tokens
+func newRefreshToken(ctx context.Context, s server.Server, userId string, familyId string) (string, error) {
+	secret := make([]byte, REFRESH_TOKEN_SIZE)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	tokenString := base64.RawURLEncoding.EncodeToString(secret)
+
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	if familyId == "" {
+		familyId = id.String() // First token of the family, created on login
+	}
+
+	err = repository.InsertRefreshToken(ctx, &models.RefreshToken{
+		Id:        id.String(),
+		FamilyId:  familyId,
+		UserId:    userId,
+		TokenHash: hashRefreshToken(tokenString),
+		ExpiresAt: time.Now().Add(s.Config().RefreshTokenTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return tokenString, nil
+}
+
+// Hash stored for a refresh token, tokens are random so they do not need a slow hash like passwords
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"hajduksanchez.com/go/rest-websockets/models"
+	"hajduksanchez.com/go/rest-websockets/repository"
+	"hajduksanchez.com/go/rest-websockets/server"
+)
+
+// Repository keeping refresh tokens in memory, other methods are not used by these tests
+type tokenRepository struct {
+	repository.Repository
+	tokens map[string]*models.RefreshToken // Tokens by hash
+	mutex  *sync.Mutex
+}
+
+func newTokenRepository() *tokenRepository {
+	return &tokenRepository{
+		tokens: make(map[string]*models.RefreshToken),
+		mutex:  &sync.Mutex{},
+	}
+}
+
+func (repo *tokenRepository) InsertRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	stored := *token
+	repo.tokens[token.TokenHash] = &stored
+	return nil
+}
+
+func (repo *tokenRepository) GetRefreshTokenByHash(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	token, ok := repo.tokens[hash]
+	if !ok {
+		return &models.RefreshToken{}, nil
+	}
+	found := *token
+	return &found, nil
+}
+
+func (repo *tokenRepository) UseRefreshToken(ctx context.Context, id string) (int64, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	for _, token := range repo.tokens {
+		if token.Id == id && token.UsedAt == nil && token.RevokedAt == nil {
+			now := time.Now()
+			token.UsedAt = &now
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (repo *tokenRepository) RevokeRefreshTokenFamily(ctx context.Context, familyId string) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	for _, token := range repo.tokens {
+		if token.FamilyId == familyId && token.RevokedAt == nil {
+			now := time.Now()
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+// Expire every refresh token stored
+func (repo *tokenRepository) expireAll() {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	for _, token := range repo.tokens {
+		token.ExpiresAt = time.Now().Add(-time.Minute)
+	}
+}
+
+func newTokenServer(t *testing.T) server.Server {
+	s, err := server.NewServer(context.Background(), &server.Config{Port: ":0", JWTSecret: "secret", DBUrl: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// Exchange the refresh token and return the status and the new tokens
+func refresh(t *testing.T, s server.Server, refreshToken string) (int, LoginResponse) {
+	body, _ := json.Marshal(RefreshTokenRequest{RefreshToken: refreshToken})
+	w := httptest.NewRecorder()
+	RefreshTokenHandler(s)(w, httptest.NewRequest(http.MethodPost, "/token/refresh", bytes.NewReader(body)))
+
+	var response LoginResponse
+	if w.Code == http.StatusOK {
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w.Code, response
+}
+
+func TestRefreshTokenHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		// Use the tokens of a new login, returning the refresh token that is sent at the end
+		steps    func(t *testing.T, s server.Server, repo *tokenRepository, login string) string
+		expected int
+	}{
+		{
+			name:     "login token",
+			steps:    func(t *testing.T, s server.Server, repo *tokenRepository, login string) string { return login },
+			expected: http.StatusOK,
+		},
+		{
+			name: "rotated token",
+			steps: func(t *testing.T, s server.Server, repo *tokenRepository, login string) string {
+				_, rotated := refresh(t, s, login)
+				return rotated.RefreshToken
+			},
+			expected: http.StatusOK,
+		},
+		{
+			name: "reused token",
+			steps: func(t *testing.T, s server.Server, repo *tokenRepository, login string) string {
+				refresh(t, s, login)
+				return login
+			},
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name: "family revoked after reuse",
+			steps: func(t *testing.T, s server.Server, repo *tokenRepository, login string) string {
+				_, rotated := refresh(t, s, login)
+				if status, _ := refresh(t, s, login); status != http.StatusUnauthorized {
+					t.Fatalf("expected reuse to be rejected, got %d", status)
+				}
+				return rotated.RefreshToken // Valid until the old one was reused
+			},
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name: "expired token",
+			steps: func(t *testing.T, s server.Server, repo *tokenRepository, login string) string {
+				repo.expireAll()
+				return login
+			},
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name:     "unknown token",
+			steps:    func(t *testing.T, s server.Server, repo *tokenRepository, login string) string { return "unknown" },
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name:     "missing token",
+			steps:    func(t *testing.T, s server.Server, repo *tokenRepository, login string) string { return "" },
+			expected: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := newTokenRepository()
+			repository.SetRepository(repo)
+			s := newTokenServer(t)
+
+			login, err := issueTokens(context.Background(), s, "user", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			refreshToken := test.steps(t, s, repo, login.RefreshToken)
+			status, response := refresh(t, s, refreshToken)
+			if status != test.expected {
+				t.Fatalf("expected status %d, got %d", test.expected, status)
+			}
+			if status == http.StatusOK && (response.Token == "" || response.RefreshToken == refreshToken) {
+				t.Fatalf("expected new tokens, got %+v", response)
+			}
+		})
+	}
+}
+
+// Only one of the requests exchanging the same token at the same time gets new tokens
+func TestRefreshTokenConcurrentReuse(t *testing.T) {
+	repo := newTokenRepository()
+	repository.SetRepository(repo)
+	s := newTokenServer(t)
+
+	login, err := issueTokens(context.Background(), s, "user", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := make(chan int, 10)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < cap(statuses); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, _ := refresh(t, s, login.RefreshToken)
+			statuses <- status
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	succeeded := 0
+	for status := range statuses {
+		if status == http.StatusOK {
+			succeeded++
+		}
+	}
+	if succeeded > 1 {
+		t.Fatalf("expected at most one refresh to succeed, got %d", succeeded)
+	}
+}
@@ -3,15 +3,13 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
-	"strings"
-	"time"
 
-	"github.com/golang-jwt/jwt"
 	"github.com/segmentio/ksuid"
 	"golang.org/x/crypto/bcrypt"
 	"hajduksanchez.com/go/rest-websockets/models"
 	"hajduksanchez.com/go/rest-websockets/repository"
 	"hajduksanchez.com/go/rest-websockets/server"
+	"hajduksanchez.com/go/rest-websockets/utils"
 )
 
 const (
@@ -30,7 +28,9 @@ type SignUpResponse struct {
 }
 
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`         // Access token
+	RefreshToken string `json:"refresh_token"` // Token to get a new access token once it expires
+	ExpiresIn    int64  `json:"expires_in"`    // Seconds until access token expires
 }
 
 func SignUpHandler(s server.Server) http.HandlerFunc {
@@ -101,59 +101,38 @@ func LoginHandler(s server.Server) http.HandlerFunc {
 			return
 		}
 
-		// Generate JWT token
-		claims := models.AppClaims{
-			UserId: user.Id,
-			StandardClaims: jwt.StandardClaims{
-				// Set token expires time
-				ExpiresAt: time.Now().Add(2 * time.Hour * 24).Unix(),
-			},
-		}
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims) // Generate token
-		tokenString, err := token.SignedString([]byte(s.Config().JWTSecret))
+		// Generate access token and start a new family of refresh tokens
+		response, err := issueTokens(r.Context(), s, user.Id, "")
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		// Generate and send Login Response
+		// Send Login Response
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(LoginResponse{
-			Token: tokenString,
-		})
+		json.NewEncoder(w).Encode(response)
 	}
 }
 
 // Get user based on Auth token
 func UserHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Get Token
-		tokenString := strings.TrimSpace(r.Header.Get("Authorization"))
-		// Validate Token
-		token, err := jwt.ParseWithClaims(tokenString, &models.AppClaims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(s.Config().JWTSecret), nil
-		})
+		// Claims of the token the auth middleware validated
+		claims, err := utils.ClaimsFromRequest(r)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
 
-		// Try to get data from Token validating if token is valid
-		if claims, ok := token.Claims.(*models.AppClaims); ok && token.Valid {
-			// Get user by ID from the Token Payload
-			user, err := repository.GetUserById(r.Context(), claims.UserId)
-			// Error getting user
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			// Response user
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(user)
-		} else {
-			// Error with Token
+		// Get user by ID from the Token Payload
+		user, err := repository.GetUserById(r.Context(), claims.UserId)
+		// Error getting user
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		// Response user
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(user)
 	}
 }
@@ -0,0 +1,272 @@
+package keys
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Time other services can cache the public keys, new keys must be published this long before signing with them
+const JWKSMaxAge time.Duration = 5 * time.Minute
+
+var (
+	errUnknownKey = errors.New("token signed with an unknown key")
+	errNoKeys     = errors.New("there are no keys to sign tokens")
+)
+
+// Key pair used to sign tokens and verify them
+type Key struct {
+	Id      string            // Sent as 'kid' on the header of the tokens, name of the file without extension
+	Method  jwt.SigningMethod // RS256 or EdDSA depending on the type of the key
+	Private crypto.PrivateKey
+	Public  crypto.PublicKey
+	Created time.Time // Modification time of the file, newer keys replace older ones to sign
+}
+
+// Keys to sign and verify tokens. Key pairs are loaded from the PEM files of a directory, without them
+// tokens are signed with the HMAC secret like before. To rotate keys add a new file, it is published
+// right away and used to sign once the activation delay passes. Remove the old file once the tokens it
+// signed expired
+type KeySet struct {
+	dir             string          // Directory with the private keys like '<kid>.pem', empty to use the secret
+	secret          []byte          // HMAC secret, also used to verify tokens signed before using key pairs
+	activationDelay time.Duration   // Time to wait before signing with a new key, so other services get it first
+	keys            map[string]*Key // Keys to verify tokens by id
+	signing         *Key            // Key to sign new tokens, nil to use the secret
+	mutex           *sync.RWMutex   // Keys are replaced while requests use them
+}
+
+// Create a key set loading the keys of the directory
+func NewKeySet(dir string, secret string, activationDelay time.Duration) (*KeySet, error) {
+	set := &KeySet{
+		dir:             dir,
+		activationDelay: activationDelay,
+		keys:            make(map[string]*Key),
+		mutex:           &sync.RWMutex{},
+	}
+	if secret != "" {
+		set.secret = []byte(secret)
+	}
+	if err := set.Load(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// Read again the keys of the directory, keeping the current ones if any of them is not valid
+func (set *KeySet) Load() error {
+	if set.dir == "" {
+		if set.secret == nil {
+			return errNoKeys
+		}
+		return nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(set.dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]*Key)
+	for _, path := range paths {
+		key, err := loadKey(path)
+		if err != nil {
+			return fmt.Errorf("invalid key %s: %w", path, err)
+		}
+		keys[key.Id] = key
+	}
+	if len(keys) == 0 {
+		return errNoKeys
+	}
+
+	signing := selectSigningKey(keys, set.activationDelay)
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+
+	if set.signing == nil || set.signing.Id != signing.Id {
+		log.Println("Signing tokens with key", signing.Id)
+	}
+	set.keys = keys
+	set.signing = signing
+	return nil
+}
+
+// Reload keys periodically until the context is done, so keys are rotated without restarting
+func (set *KeySet) Run(ctx context.Context, interval time.Duration) {
+	if set.dir == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := set.Load(); err != nil {
+				log.Println("Error reloading keys", err)
+			}
+		}
+	}
+}
+
+// Sign the claims with the current key
+func (set *KeySet) Sign(claims jwt.Claims) (string, error) {
+	set.mutex.RLock()
+	defer set.mutex.RUnlock()
+
+	if set.signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(set.secret)
+	}
+	token := jwt.NewWithClaims(set.signing.Method, claims)
+	token.Header["kid"] = set.signing.Id // Other services find the key to verify it by this id
+	return token.SignedString(set.signing.Private)
+}
+
+// Key to verify the token, it must be signed with the algorithm of the key so nobody can sign
+// tokens with the public key as HMAC secret
+func (set *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	set.mutex.RLock()
+	defer set.mutex.RUnlock()
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		// Tokens signed with the secret, before using key pairs or because there are no keys
+		if set.secret == nil || token.Method != jwt.SigningMethodHS256 {
+			return nil, errUnknownKey
+		}
+		return set.secret, nil
+	}
+
+	key, ok := set.keys[kid]
+	if !ok || key.Method.Alg() != token.Method.Alg() {
+		return nil, errUnknownKey
+	}
+	return key.Public, nil
+}
+
+// Public keys to publish, every key of the set so tokens signed with keys being retired are still valid
+func (set *KeySet) JWKS() JSONWebKeySet {
+	set.mutex.RLock()
+	defer set.mutex.RUnlock()
+
+	jwks := JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(set.keys))}
+	for _, key := range set.keys {
+		jwks.Keys = append(jwks.Keys, newJSONWebKey(key))
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].Kid < jwks.Keys[j].Kid
+	})
+	return jwks
+}
+
+// Read a RSA or Ed25519 private key from a PEM file
+func loadKey(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{
+		Id:      strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		Created: info.ModTime(),
+	}
+	if private, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+		key.Method = jwt.SigningMethodRS256
+		key.Private = private
+		key.Public = &private.PublicKey
+		return key, nil
+	}
+	private, err := jwt.ParseEdPrivateKeyFromPEM(data)
+	if err != nil {
+		return nil, errors.New("expected a RSA or Ed25519 private key")
+	}
+	key.Method = jwt.SigningMethodEdDSA
+	key.Private = private
+	key.Public = private.(ed25519.PrivateKey).Public()
+	return key, nil
+}
+
+// Newest key older than the activation delay, or the oldest one if every key is newer
+func selectSigningKey(keys map[string]*Key, activationDelay time.Duration) *Key {
+	sorted := make([]*Key, 0, len(keys))
+	for _, key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Created.Equal(sorted[j].Created) {
+			return sorted[i].Id < sorted[j].Id
+		}
+		return sorted[i].Created.Before(sorted[j].Created)
+	})
+
+	activated := time.Now().Add(-activationDelay)
+	signing := sorted[0]
+	for _, key := range sorted {
+		if key.Created.After(activated) {
+			break
+		}
+		signing = key
+	}
+	return signing
+}
+
+// Public key on JWK format, RFC 7517
+type JSONWebKey struct {
+	Kty string `json:"kty"`           // Key type, 'RSA' or 'OKP' for Ed25519
+	Kid string `json:"kid"`           // Id of the key, sent on the header of the tokens
+	Use string `json:"use"`           // Always 'sig', keys are only used to sign
+	Alg string `json:"alg"`           // Algorithm of the tokens signed with the key
+	N   string `json:"n,omitempty"`   // Modulus of RSA keys
+	E   string `json:"e,omitempty"`   // Exponent of RSA keys
+	Crv string `json:"crv,omitempty"` // Curve of OKP keys, always 'Ed25519'
+	X   string `json:"x,omitempty"`   // Public key of OKP keys
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+func newJSONWebKey(key *Key) JSONWebKey {
+	jwk := JSONWebKey{
+		Kid: key.Id,
+		Use: "sig",
+		Alg: key.Method.Alg(),
+	}
+	switch public := key.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = jwt.EncodeSegment(public.N.Bytes())
+		jwk.E = jwt.EncodeSegment(bigEndian(public.E))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = jwt.EncodeSegment(public)
+	}
+	return jwk
+}
+
+// Big endian bytes of the number without leading zeros, like RSA exponents are encoded
+func bigEndian(number int) []byte {
+	bytes := make([]byte, 0, 8)
+	for ; number > 0; number >>= 8 {
+		bytes = append([]byte{byte(number)}, bytes...)
+	}
+	return bytes
+}
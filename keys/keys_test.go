@@ -0,0 +1,295 @@
+package keys
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Key pairs shared by the tests, generating RSA keys is slow
+var (
+	rsaKey, _          = rsa.GenerateKey(rand.Reader, 2048)
+	edPublic, edKey, _ = ed25519.GenerateKey(rand.Reader)
+)
+
+// Key set with a RSA key, an Ed25519 key and the secret
+func newTestKeySet() *KeySet {
+	return &KeySet{
+		secret: []byte("secret"),
+		keys: map[string]*Key{
+			"rsa": {Id: "rsa", Method: jwt.SigningMethodRS256, Private: rsaKey, Public: &rsaKey.PublicKey},
+			"ed":  {Id: "ed", Method: jwt.SigningMethodEdDSA, Private: edKey, Public: edPublic},
+		},
+		mutex: &sync.RWMutex{},
+	}
+}
+
+// Token signed with the method and key specified, with the kid on the header if it is not empty
+func signTestToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}) string {
+	token := jwt.NewWithClaims(method, jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestKeyfunc(t *testing.T) {
+	publicPEM, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		token  func(t *testing.T) string
+		secret bool // Key set still has the secret
+		valid  bool
+	}{
+		{
+			name:   "RSA key",
+			token:  func(t *testing.T) string { return signTestToken(t, jwt.SigningMethodRS256, "rsa", rsaKey) },
+			secret: true,
+			valid:  true,
+		},
+		{
+			name:   "Ed25519 key",
+			token:  func(t *testing.T) string { return signTestToken(t, jwt.SigningMethodEdDSA, "ed", edKey) },
+			secret: true,
+			valid:  true,
+		},
+		{
+			name:   "secret without kid",
+			token:  func(t *testing.T) string { return signTestToken(t, jwt.SigningMethodHS256, "", []byte("secret")) },
+			secret: true,
+			valid:  true,
+		},
+		{
+			name:   "secret without kid once the secret is removed",
+			token:  func(t *testing.T) string { return signTestToken(t, jwt.SigningMethodHS256, "", []byte("secret")) },
+			secret: false,
+			valid:  false,
+		},
+		{
+			name: "HS256 with the kid of a RSA key",
+			token: func(t *testing.T) string {
+				return signTestToken(t, jwt.SigningMethodHS256, "rsa", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicPEM}))
+			},
+			secret: true,
+			valid:  false,
+		},
+		{
+			name:   "HS256 with the kid of a RSA key signed with the secret",
+			token:  func(t *testing.T) string { return signTestToken(t, jwt.SigningMethodHS256, "rsa", []byte("secret")) },
+			secret: true,
+			valid:  false,
+		},
+		{
+			name:   "RS256 with the kid of an Ed25519 key",
+			token:  func(t *testing.T) string { return signTestToken(t, jwt.SigningMethodRS256, "ed", rsaKey) },
+			secret: true,
+			valid:  false,
+		},
+		{
+			name:   "RS256 without kid",
+			token:  func(t *testing.T) string { return signTestToken(t, jwt.SigningMethodRS256, "", rsaKey) },
+			secret: true,
+			valid:  false,
+		},
+		{
+			name:   "unknown kid",
+			token:  func(t *testing.T) string { return signTestToken(t, jwt.SigningMethodRS256, "removed", rsaKey) },
+			secret: true,
+			valid:  false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			set := newTestKeySet()
+			if !test.secret {
+				set.secret = nil
+			}
+			token, err := jwt.Parse(test.token(t), set.Keyfunc)
+			valid := err == nil && token.Valid
+			if valid != test.valid {
+				t.Fatalf("expected valid %v, got %v (%v)", test.valid, valid, err)
+			}
+		})
+	}
+}
+
+func TestSelectSigningKey(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		created  map[string]time.Time // Creation time of each key by id
+		delay    time.Duration
+		expected string
+	}{
+		{
+			name:     "single key",
+			created:  map[string]time.Time{"a": now},
+			delay:    time.Hour,
+			expected: "a",
+		},
+		{
+			name:     "newest key without delay",
+			created:  map[string]time.Time{"old": now.Add(-time.Hour), "new": now.Add(-time.Second)},
+			delay:    0,
+			expected: "new",
+		},
+		{
+			name:     "new key waits for the delay",
+			created:  map[string]time.Time{"old": now.Add(-time.Hour), "new": now.Add(-time.Minute)},
+			delay:    6 * time.Minute,
+			expected: "old",
+		},
+		{
+			name:     "new key after the delay",
+			created:  map[string]time.Time{"old": now.Add(-time.Hour), "new": now.Add(-7 * time.Minute)},
+			delay:    6 * time.Minute,
+			expected: "new",
+		},
+		{
+			name:     "newest of the activated keys",
+			created:  map[string]time.Time{"a": now.Add(-time.Hour), "b": now.Add(-30 * time.Minute), "c": now.Add(-time.Minute)},
+			delay:    6 * time.Minute,
+			expected: "b",
+		},
+		{
+			name:     "oldest key when none is activated",
+			created:  map[string]time.Time{"a": now.Add(-2 * time.Minute), "b": now.Add(-time.Minute)},
+			delay:    6 * time.Minute,
+			expected: "a",
+		},
+		{
+			name:     "same creation time ordered by id",
+			created:  map[string]time.Time{"b": now.Add(-time.Hour), "a": now.Add(-time.Hour)},
+			delay:    6 * time.Minute,
+			expected: "b",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keys := make(map[string]*Key)
+			for id, created := range test.created {
+				keys[id] = &Key{Id: id, Created: created}
+			}
+			if signing := selectSigningKey(keys, test.delay); signing.Id != test.expected {
+				t.Fatalf("expected key %s, got %s", test.expected, signing.Id)
+			}
+		})
+	}
+}
+
+// Keys written on the directory are published right away, and used to sign after the delay
+func TestLoadWaitsForActivationDelay(t *testing.T) {
+	dir := t.TempDir()
+	writeKey := func(id string, block *pem.Block, created time.Time) {
+		path := filepath.Join(dir, id+".pem")
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, created, created); err != nil {
+			t.Fatal(err)
+		}
+	}
+	edBytes, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKey("old", &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}, time.Now().Add(-time.Hour))
+	writeKey("new", &pem.Block{Type: "PRIVATE KEY", Bytes: edBytes}, time.Now().Add(-time.Minute))
+
+	set, err := NewKeySet(dir, "", 6*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.JWKS().Keys) != 2 {
+		t.Fatalf("expected both keys to be published, got %+v", set.JWKS())
+	}
+	signed, err := set.Sign(jwt.StandardClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwt.Parse(signed, set.Keyfunc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := token.Header["kid"]; kid != "old" {
+		t.Fatalf("expected token signed with the old key, got %v", kid)
+	}
+}
+
+func TestJSONWebKey(t *testing.T) {
+	t.Run("RSA", func(t *testing.T) {
+		jwk := newJSONWebKey(&Key{Id: "rsa", Method: jwt.SigningMethodRS256, Public: &rsaKey.PublicKey})
+		if jwk.Kty != "RSA" || jwk.Alg != "RS256" || jwk.Use != "sig" || jwk.Kid != "rsa" {
+			t.Fatalf("unexpected key %+v", jwk)
+		}
+		if jwk.E != "AQAB" { // 65537
+			t.Fatalf("expected exponent AQAB, got %s", jwk.E)
+		}
+		modulus, err := jwt.DecodeSegment(jwk.N)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if new(big.Int).SetBytes(modulus).Cmp(rsaKey.N) != 0 {
+			t.Fatal("modulus does not match the key")
+		}
+		if jwk.Crv != "" || jwk.X != "" {
+			t.Fatalf("unexpected OKP fields on RSA key %+v", jwk)
+		}
+	})
+
+	t.Run("Ed25519", func(t *testing.T) {
+		jwk := newJSONWebKey(&Key{Id: "ed", Method: jwt.SigningMethodEdDSA, Public: edPublic})
+		if jwk.Kty != "OKP" || jwk.Crv != "Ed25519" || jwk.Alg != "EdDSA" || jwk.Use != "sig" {
+			t.Fatalf("unexpected key %+v", jwk)
+		}
+		x, err := jwt.DecodeSegment(jwk.X)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(x, edPublic) {
+			t.Fatal("public key does not match the key")
+		}
+		if jwk.N != "" || jwk.E != "" {
+			t.Fatalf("unexpected RSA fields on OKP key %+v", jwk)
+		}
+	})
+}
+
+func TestBigEndian(t *testing.T) {
+	tests := []struct {
+		number   int
+		expected []byte
+	}{
+		{number: 3, expected: []byte{3}},
+		{number: 255, expected: []byte{0xff}},
+		{number: 256, expected: []byte{1, 0}},
+		{number: 65537, expected: []byte{1, 0, 1}},
+	}
+
+	for _, test := range tests {
+		if encoded := bigEndian(test.number); !bytes.Equal(encoded, test.expected) {
+			t.Fatalf("expected %v for %d, got %v", test.expected, test.number, encoded)
+		}
+	}
+}
@@ -26,35 +26,219 @@ func main() {
 	JWT_SECRET := os.Getenv("JWT_SECRET")
 	DATA_BASE_URL := os.Getenv("DATA_BASE_URL")
 
+	SHUTDOWN_TIMEOUT, err := utils.GetEnvDuration("SHUTDOWN_TIMEOUT")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Optional key pairs to sign tokens, so other services can verify them with the public keys
+	JWT_KEYS_DIR := os.Getenv("JWT_KEYS_DIR")
+	JWT_KEYS_RELOAD, err := utils.GetEnvDuration("JWT_KEYS_RELOAD")
+	if err != nil {
+		log.Fatal(err)
+	}
+	JWT_KEY_ACTIVATION_DELAY, err := utils.GetEnvDuration("JWT_KEY_ACTIVATION_DELAY")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Optional token lifetime environments
+	ACCESS_TOKEN_TTL, err := utils.GetEnvDuration("ACCESS_TOKEN_TTL")
+	if err != nil {
+		log.Fatal(err)
+	}
+	REFRESH_TOKEN_TTL, err := utils.GetEnvDuration("REFRESH_TOKEN_TTL")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Optional websocket heartbeat environments, defaults are used if not specified
+	WRITE_WAIT, err := utils.GetEnvDuration("WEBSOCKET_WRITE_WAIT")
+	if err != nil {
+		log.Fatal(err)
+	}
+	PONG_WAIT, err := utils.GetEnvDuration("WEBSOCKET_PONG_WAIT")
+	if err != nil {
+		log.Fatal(err)
+	}
+	PING_PERIOD, err := utils.GetEnvDuration("WEBSOCKET_PING_PERIOD")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	POLL_TIMEOUT, err := utils.GetEnvDuration("WEBSOCKET_POLL_TIMEOUT")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	TYPING_THROTTLE, err := utils.GetEnvDuration("WEBSOCKET_TYPING_THROTTLE")
+	if err != nil {
+		log.Fatal(err)
+	}
+	TYPING_TIMEOUT, err := utils.GetEnvDuration("WEBSOCKET_TYPING_TIMEOUT")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Optional websocket queue environments
+	SEND_BUFFER_SIZE, err := utils.GetEnvInt("WEBSOCKET_SEND_BUFFER_SIZE")
+	if err != nil {
+		log.Fatal(err)
+	}
+	SLOW_CONSUMER_POLICY := os.Getenv("WEBSOCKET_SLOW_CONSUMER_POLICY")
+	REPLAY_BUFFER_SIZE, err := utils.GetEnvInt("WEBSOCKET_REPLAY_BUFFER_SIZE")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Optional websocket concurrency environments
+	SHARDS, err := utils.GetEnvInt("WEBSOCKET_SHARDS")
+	if err != nil {
+		log.Fatal(err)
+	}
+	WORKERS, err := utils.GetEnvInt("WEBSOCKET_WORKERS")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Optional websocket compression and size environments
+	COMPRESSION, err := utils.GetEnvBool("WEBSOCKET_COMPRESSION")
+	if err != nil {
+		log.Fatal(err)
+	}
+	COMPRESSION_LEVEL, err := utils.GetEnvInt("WEBSOCKET_COMPRESSION_LEVEL")
+	if err != nil {
+		log.Fatal(err)
+	}
+	COMPRESSION_THRESHOLD, err := utils.GetEnvInt("WEBSOCKET_COMPRESSION_THRESHOLD")
+	if err != nil {
+		log.Fatal(err)
+	}
+	MAX_MESSAGE_SIZE, err := utils.GetEnvInt("WEBSOCKET_MAX_MESSAGE_SIZE")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Optional websocket limits, zero means no limit
+	MAX_CONNECTIONS, err := utils.GetEnvInt("WEBSOCKET_MAX_CONNECTIONS")
+	if err != nil {
+		log.Fatal(err)
+	}
+	MAX_CONNECTIONS_PER_USER, err := utils.GetEnvInt("WEBSOCKET_MAX_CONNECTIONS_PER_USER")
+	if err != nil {
+		log.Fatal(err)
+	}
+	MAX_CONNECTIONS_PER_IP, err := utils.GetEnvInt("WEBSOCKET_MAX_CONNECTIONS_PER_IP")
+	if err != nil {
+		log.Fatal(err)
+	}
+	TRUST_PROXY, err := utils.GetEnvBool("WEBSOCKET_TRUST_PROXY")
+	if err != nil {
+		log.Fatal(err)
+	}
+	MESSAGE_RATE, err := utils.GetEnvInt("WEBSOCKET_MESSAGE_RATE")
+	if err != nil {
+		log.Fatal(err)
+	}
+	MESSAGE_BURST, err := utils.GetEnvInt("WEBSOCKET_MESSAGE_BURST")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Websocket origins allowed, any origin is allowed on dev mode
+	ALLOWED_ORIGINS := utils.GetEnvList("WEBSOCKET_ALLOWED_ORIGINS")
+	DEV_MODE, err := utils.GetEnvBool("DEV_MODE")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	BACKPLANE := os.Getenv("WEBSOCKET_BACKPLANE")     // Needed when running many instances
+	REVOCATION_STORE := os.Getenv("REVOCATION_STORE") // Needed when running many instances
+
 	// Create the new server
 	server, err := server.NewServer(context.Background(), &server.Config{
 		JWTSecret: JWT_SECRET,
 		Port:      PORT,
 		DBUrl:     DATA_BASE_URL,
+
+		JWTKeysDir:            JWT_KEYS_DIR,
+		JWTKeysReload:         JWT_KEYS_RELOAD,
+		JWTKeyActivationDelay: JWT_KEY_ACTIVATION_DELAY,
+
+		ShutdownTimeout: SHUTDOWN_TIMEOUT,
+
+		AccessTokenTTL:  ACCESS_TOKEN_TTL,
+		RefreshTokenTTL: REFRESH_TOKEN_TTL,
+
+		WriteWait:  WRITE_WAIT,
+		PongWait:   PONG_WAIT,
+		PingPeriod: PING_PERIOD,
+
+		PollTimeout: POLL_TIMEOUT,
+
+		TypingThrottle: TYPING_THROTTLE,
+		TypingTimeout:  TYPING_TIMEOUT,
+
+		SendBufferSize:     SEND_BUFFER_SIZE,
+		SlowConsumerPolicy: SLOW_CONSUMER_POLICY,
+		ReplayBufferSize:   REPLAY_BUFFER_SIZE,
+
+		Shards:  SHARDS,
+		Workers: WORKERS,
+
+		EnableCompression:    COMPRESSION,
+		CompressionLevel:     COMPRESSION_LEVEL,
+		CompressionThreshold: COMPRESSION_THRESHOLD,
+		MaxMessageSize:       int64(MAX_MESSAGE_SIZE),
+
+		MaxConnections:        MAX_CONNECTIONS,
+		MaxConnectionsPerUser: MAX_CONNECTIONS_PER_USER,
+		MaxConnectionsPerIP:   MAX_CONNECTIONS_PER_IP,
+		TrustProxy:            TRUST_PROXY,
+		MessageRate:           MESSAGE_RATE,
+		MessageBurst:          MESSAGE_BURST,
+
+		AllowedOrigins: ALLOWED_ORIGINS,
+		DevMode:        DEV_MODE,
+
+		Backplane:       BACKPLANE,
+		RevocationStore: REVOCATION_STORE,
 	})
 
 	if err != nil {
-		log.Fatal("Error creating server")
+		log.Fatal("Error creating server: ", err)
 	}
 
-	server.Start(BindRoutes) // Start the server
+	server.Start(BindRoutes) // Start the server, it returns once the server stopped
 }
 
 // Function to handle routes and start server
 func BindRoutes(server server.Server, router *mux.Router) {
-	// Define middleware
-	router.Use(middleware.AuthMiddleware(server))
+	// Define middleware, every route declares who can call it and routes without a policy need a valid token
+	policies := middleware.NewPolicies()
+	router.Use(middleware.AuthMiddleware(server, policies))
 
 	// Define endpoints and methods for endpoints
-	router.HandleFunc(utils.Home, handlers.HomeHandler(server)).Methods(http.MethodGet)
-	router.HandleFunc(utils.Register, handlers.SignUpHandler(server)).Methods(http.MethodPost)
-	router.HandleFunc(utils.Login, handlers.LoginHandler(server)).Methods(http.MethodPost)
-	router.HandleFunc(utils.User, handlers.UserHandler(server)).Methods(http.MethodGet)
-	router.HandleFunc(utils.Post, handlers.InsertPostHandler(server)).Methods(http.MethodPost)
-	router.HandleFunc(utils.PostId, handlers.GetPostById(server)).Methods(http.MethodGet)
-	router.HandleFunc(utils.PostId, handlers.UpdatePostHandler(server)).Methods(http.MethodPut)
-	router.HandleFunc(utils.PostId, handlers.DeletePostHandler(server)).Methods(http.MethodDelete)
-	router.HandleFunc(utils.Posts, handlers.ListPostHandler(server)).Methods(http.MethodGet)
-
-	router.HandleFunc(utils.WebSocket, server.Hub().HandleWebSocket)
+	policies.Set(router.HandleFunc(utils.Home, handlers.HomeHandler(server)).Methods(http.MethodGet), middleware.Public)
+	policies.Set(router.HandleFunc(utils.Register, handlers.SignUpHandler(server)).Methods(http.MethodPost), middleware.Public)
+	policies.Set(router.HandleFunc(utils.Login, handlers.LoginHandler(server)).Methods(http.MethodPost), middleware.Public)
+	policies.Set(router.HandleFunc(utils.RefreshToken, handlers.RefreshTokenHandler(server)).Methods(http.MethodPost), middleware.Public) // Access token already expired when refreshing
+	policies.Set(router.HandleFunc(utils.JWKS, handlers.JWKSHandler(server)).Methods(http.MethodGet), middleware.Public)                  // Public keys for other services to verify tokens
+	policies.Set(router.HandleFunc(utils.Logout, handlers.LogoutHandler(server)).Methods(http.MethodPost), middleware.Authenticated)
+	policies.Set(router.HandleFunc(utils.LogoutAll, handlers.LogoutAllHandler(server)).Methods(http.MethodPost), middleware.Authenticated)
+	policies.Set(router.HandleFunc(utils.User, handlers.UserHandler(server)).Methods(http.MethodGet), middleware.Authenticated)
+	policies.Set(router.HandleFunc(utils.UserMessages, handlers.SendUserMessageHandler(server)).Methods(http.MethodPost), middleware.Authenticated)
+	policies.Set(router.HandleFunc(utils.Post, handlers.InsertPostHandler(server)).Methods(http.MethodPost), middleware.Authenticated)
+	policies.Set(router.HandleFunc(utils.PostId, handlers.GetPostById(server)).Methods(http.MethodGet), middleware.Authenticated)
+	policies.Set(router.HandleFunc(utils.PostId, handlers.UpdatePostHandler(server)).Methods(http.MethodPut), middleware.Authenticated)
+	policies.Set(router.HandleFunc(utils.PostId, handlers.DeletePostHandler(server)).Methods(http.MethodDelete), middleware.Authenticated)
+	policies.Set(router.HandleFunc(utils.Posts, handlers.ListPostHandler(server)).Methods(http.MethodGet), middleware.Authenticated)
+
+	policies.Set(router.HandleFunc(utils.Presence, handlers.PresenceHandler(server)).Methods(http.MethodGet), middleware.Authenticated)
+
+	// Browsers can not send headers on websockets and event streams, the hub authenticates them with the token of the request
+	policies.Set(router.HandleFunc(utils.WebSocket, server.Hub().HandleWebSocket), middleware.Public)
+	policies.Set(router.HandleFunc(utils.Events, server.Hub().HandleEvents).Methods(http.MethodGet), middleware.Public) // Fallback when websockets are blocked
+	policies.Set(router.HandleFunc(utils.Poll, server.Hub().HandlePoll).Methods(http.MethodGet), middleware.Public)     // Fallback when streaming is not supported
+	handlers.RegisterRPCMethods(server)                                                                                 // Methods clients can call over the websocket connection
 }
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
+	"hajduksanchez.com/go/rest-websockets/models"
+	"hajduksanchez.com/go/rest-websockets/server"
+)
+
+// Policy each route must have
+type routePolicy struct {
+	method string
+	path   string   // Path to call, with values for the path variables
+	public bool     // Can be called without token
+	scopes []string // Scopes the token needs, besides being valid
+}
+
+var routePolicies = []routePolicy{
+	{method: http.MethodGet, path: "/", public: true},
+	{method: http.MethodPost, path: "/sign_up", public: true},
+	{method: http.MethodPost, path: "/login", public: true},
+	{method: http.MethodPost, path: "/token/refresh", public: true},
+	{method: http.MethodGet, path: "/.well-known/jwks.json", public: true},
+	{method: http.MethodPost, path: "/logout"},
+	{method: http.MethodPost, path: "/logout/all"},
+	{method: http.MethodGet, path: "/user"},
+	{method: http.MethodPost, path: "/users/1/messages"},
+	{method: http.MethodPost, path: "/post"},
+	{method: http.MethodGet, path: "/post/1"},
+	{method: http.MethodPut, path: "/post/1"},
+	{method: http.MethodDelete, path: "/post/1"},
+	{method: http.MethodGet, path: "/posts"},
+	{method: http.MethodGet, path: "/presence"},
+	{method: http.MethodGet, path: "/web-socket", public: true}, // The hub reads the token from the request
+	{method: http.MethodGet, path: "/events", public: true},
+	{method: http.MethodGet, path: "/poll", public: true},
+}
+
+// Router of the server with every handler replaced, so only the auth middleware runs
+func newPolicyRouter(t *testing.T) (server.Server, *mux.Router, int) {
+	s, err := server.NewServer(context.Background(), &server.Config{Port: ":0", JWTSecret: "secret", DBUrl: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	BindRoutes(s, router)
+
+	routes := 0
+	err = router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		route.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+		routes++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, router, routes
+}
+
+// Token of the user with the scopes specified
+func signToken(t *testing.T, s server.Server, scopes ...string) string {
+	token, err := s.Keys().Sign(models.AppClaims{
+		UserId: "user",
+		Scope:  strings.Join(scopes, " "),
+		StandardClaims: jwt.StandardClaims{
+			Id:        "token",
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func call(router *mux.Router, method string, path string, token string) int {
+	r := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		r.Header.Set("Authorization", token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestRoutePolicies(t *testing.T) {
+	s, router, routes := newPolicyRouter(t)
+	if routes != len(routePolicies) {
+		t.Fatalf("expected %d routes, got %d, every route needs its policy on the test", len(routePolicies), routes)
+	}
+
+	for _, route := range routePolicies {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			withoutToken := http.StatusUnauthorized
+			if route.public {
+				withoutToken = http.StatusOK
+			}
+			if status := call(router, route.method, route.path, ""); status != withoutToken {
+				t.Errorf("without token expected %d, got %d", withoutToken, status)
+			}
+			if status := call(router, route.method, route.path, "invalid"); !route.public && status != http.StatusUnauthorized {
+				t.Errorf("with invalid token expected %d, got %d", http.StatusUnauthorized, status)
+			}
+
+			// Token with the scopes of the route, and one missing them
+			if status := call(router, route.method, route.path, signToken(t, s, route.scopes...)); status != http.StatusOK {
+				t.Errorf("with valid token expected %d, got %d", http.StatusOK, status)
+			}
+			missingScope := http.StatusOK
+			if len(route.scopes) > 0 && !route.public {
+				missingScope = http.StatusForbidden
+			}
+			if status := call(router, route.method, route.path, signToken(t, s, "other")); status != missingScope {
+				t.Errorf("with token missing scopes expected %d, got %d", missingScope, status)
+			}
+		})
+	}
+}
+
+// Policy is taken from the route matched, not from the text of the path
+func TestRoutePoliciesMatchRoutes(t *testing.T) {
+	_, router, _ := newPolicyRouter(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+	}{
+		{name: "public route on the query", method: http.MethodGet, path: "/user?next=/login"},
+		{name: "public route as prefix", method: http.MethodGet, path: "/posts/login"},
+		{name: "public route as path variable", method: http.MethodGet, path: "/post/login"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if status := call(router, test.method, test.path, ""); status == http.StatusOK {
+				t.Fatalf("expected %s %s to need a token", test.method, test.path)
+			}
+		})
+	}
+}
+
+// Tokens revoked on logout are rejected by every route that needs a token
+func TestRevokedTokens(t *testing.T) {
+	s, router, _ := newPolicyRouter(t)
+	ctx := context.Background()
+
+	issue := func(jti string, issued time.Time) string {
+		token, err := s.Keys().Sign(models.AppClaims{
+			UserId:     "user",
+			IssuedAtMs: issued.UnixMilli(),
+			StandardClaims: jwt.StandardClaims{
+				Id:        jti,
+				IssuedAt:  issued.Unix(),
+				ExpiresAt: issued.Add(time.Minute).Unix(),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	logout := time.Now()
+	loggedOut := issue("logged-out", logout.Add(-time.Minute))
+	everywhere := issue("everywhere", logout.Add(-time.Millisecond))
+	loginAgain := issue("login-again", logout.Add(time.Millisecond)) // Same second as the logout
+	if err := s.Revocations().Revoke(ctx, "logged-out", logout.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Revocations().RevokeUser(ctx, "user", logout); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		expected int
+	}{
+		{name: "token revoked", token: loggedOut, expected: http.StatusUnauthorized},
+		{name: "token issued before logging out everywhere", token: everywhere, expected: http.StatusUnauthorized},
+		{name: "token issued after logging out everywhere", token: loginAgain, expected: http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if status := call(router, http.MethodGet, "/user", test.token); status != test.expected {
+				t.Fatalf("expected %d, got %d", test.expected, status)
+			}
+		})
+	}
+}
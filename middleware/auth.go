@@ -4,52 +4,37 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/golang-jwt/jwt"
-	"hajduksanchez.com/go/rest-websockets/models"
+	"github.com/gorilla/mux"
 	"hajduksanchez.com/go/rest-websockets/server"
 	"hajduksanchez.com/go/rest-websockets/utils"
 )
 
-var (
-	// List of routes that not needs authentication
-	NO_AUTH_NEEDED = []string{
-		utils.Login,
-		utils.Register,
-	}
-)
-
-// Function to know if it is important to check token or not based on route
-func shouldCheckToken(route string) bool {
-	for _, route := range NO_AUTH_NEEDED {
-		if strings.Contains(route, route) {
-			return false
-		}
-	}
-	return true
-}
-
 // Middleware returns next function handler specified
 // That is because middleware works as a previous handler function that surround a handler function
-// If everything ok, handler function passed will be executed
-func AuthMiddleware(s server.Server) func(h http.Handler) http.Handler {
+// If everything ok, handler function passed will be executed with the claims of the token on the request context
+func AuthMiddleware(s server.Server, policies *Policies) func(h http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Validate if route needs to be authenticated
-			if !shouldCheckToken(r.URL.Path) {
+			// Validate if route needs to be authenticated, based on the route matched and not on the path
+			policy := policies.Get(mux.CurrentRoute(r))
+			if policy.public {
 				next.ServeHTTP(w, r) // Continue with handler function of the specific path
 				return
 			}
 
 			// Get Token and validate if user has permission based on this specific token
 			tokenString := strings.TrimSpace(r.Header.Get("Authorization"))
-			_, err := jwt.ParseWithClaims(tokenString, &models.AppClaims{}, func(token *jwt.Token) (interface{}, error) {
-				return []byte(s.Config().JWTSecret), nil
-			})
+			claims, err := s.ValidateToken(r.Context(), tokenString)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusUnauthorized)
 				return
 			}
-			next.ServeHTTP(w, r) // Continue with handler function
+			if !policy.allows(claims) {
+				http.Error(w, "token does not have the scopes needed", http.StatusForbidden)
+				return
+			}
+			// Handlers read the claims from the context instead of parsing the token again
+			next.ServeHTTP(w, r.WithContext(utils.WithClaims(r.Context(), claims)))
 		})
 	}
 }
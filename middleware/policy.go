@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"hajduksanchez.com/go/rest-websockets/models"
+)
+
+// Authentication required by a route
+type Policy struct {
+	public bool     // Anybody can call the route, the handler authenticates by itself if it needs to
+	scopes []string // Scopes the token must have, besides being valid
+}
+
+var (
+	Public        = Policy{public: true} // No token needed, like login
+	Authenticated = Policy{}             // Any valid token
+)
+
+// Valid token with every scope specified
+func RequireScopes(scopes ...string) Policy {
+	return Policy{scopes: scopes}
+}
+
+// Know if the claims have every scope of the policy
+func (policy Policy) allows(claims *models.AppClaims) bool {
+	granted := strings.Fields(claims.Scope)
+	for _, scope := range policy.scopes {
+		found := false
+		for _, grant := range granted {
+			if grant == scope {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Policy of each route, declared when routes are registered. Routes without a policy need a valid token,
+// so a route can not be public by mistake
+type Policies struct {
+	routes map[*mux.Route]Policy
+	mutex  *sync.RWMutex
+}
+
+func NewPolicies() *Policies {
+	return &Policies{
+		routes: make(map[*mux.Route]Policy),
+		mutex:  &sync.RWMutex{},
+	}
+}
+
+// Set the policy of the route and return it, so it can be used when registering it
+func (policies *Policies) Set(route *mux.Route, policy Policy) *mux.Route {
+	policies.mutex.Lock()
+	defer policies.mutex.Unlock()
+
+	policies.routes[route] = policy
+	return route
+}
+
+// Policy of the route, authenticated if it was not declared
+func (policies *Policies) Get(route *mux.Route) Policy {
+	policies.mutex.RLock()
+	defer policies.mutex.RUnlock()
+
+	if policy, ok := policies.routes[route]; ok {
+		return policy
+	}
+	return Authenticated
+}
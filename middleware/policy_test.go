@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/gorilla/mux"
+	"hajduksanchez.com/go/rest-websockets/models"
+)
+
+func TestPoliciesGet(t *testing.T) {
+	router := mux.NewRouter()
+	public := router.NewRoute().Path("/public")
+	scoped := router.NewRoute().Path("/scoped")
+	undeclared := router.NewRoute().Path("/undeclared")
+
+	policies := NewPolicies()
+	policies.Set(public, Public)
+	policies.Set(scoped, RequireScopes("admin"))
+
+	tests := []struct {
+		name   string
+		route  *mux.Route
+		public bool
+		scopes []string
+	}{
+		{name: "public route", route: public, public: true},
+		{name: "route with scopes", route: scoped, scopes: []string{"admin"}},
+		{name: "route without policy needs a token", route: undeclared},
+		{name: "request without route needs a token", route: nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := policies.Get(test.route)
+			if policy.public != test.public {
+				t.Fatalf("expected public %v, got %v", test.public, policy.public)
+			}
+			if len(policy.scopes) != len(test.scopes) {
+				t.Fatalf("expected scopes %v, got %v", test.scopes, policy.scopes)
+			}
+		})
+	}
+}
+
+func TestPolicyAllows(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   Policy
+		scope    string // Scopes of the token
+		expected bool
+	}{
+		{name: "authenticated without scopes", policy: Authenticated, scope: "", expected: true},
+		{name: "authenticated with scopes", policy: Authenticated, scope: "admin", expected: true},
+		{name: "scope granted", policy: RequireScopes("admin"), scope: "admin", expected: true},
+		{name: "scope missing", policy: RequireScopes("admin"), scope: "", expected: false},
+		{name: "other scope", policy: RequireScopes("admin"), scope: "posts:write", expected: false},
+		{name: "scope as prefix of other", policy: RequireScopes("admin"), scope: "administrator", expected: false},
+		{name: "every scope granted", policy: RequireScopes("admin", "posts:write"), scope: "posts:write admin", expected: true},
+		{name: "one scope missing", policy: RequireScopes("admin", "posts:write"), scope: "admin", expected: false},
+		{name: "extra spaces", policy: RequireScopes("admin"), scope: "  admin  ", expected: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := &models.AppClaims{UserId: "user", Scope: test.scope}
+			if allowed := test.policy.allows(claims); allowed != test.expected {
+				t.Fatalf("expected %v for scopes %q, got %v", test.expected, test.scope, allowed)
+			}
+		})
+	}
+}
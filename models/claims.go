@@ -4,5 +4,7 @@ import "github.com/golang-jwt/jwt"
 
 type AppClaims struct {
 	UserId             string `json:"userId"`
+	Scope              string `json:"scope,omitempty"`  // Permissions of the token separated by spaces, like 'posts:write admin'
+	IssuedAtMs         int64  `json:"iat_ms,omitempty"` // Issue time with milliseconds, 'iat' only has seconds
 	jwt.StandardClaims        // AppClaims contains all properties of the package
 }
@@ -0,0 +1,5 @@
+package models
+
+type ErrorPayload struct {
+	Message string `json:"message"` // Description of what went wrong
+}
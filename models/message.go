@@ -3,4 +3,14 @@ package models
 type WebsocketMessage struct {
 	Type    string      `json:"type"`    // Type of message to send on websocket (direct, broadcast, etc)
 	Payload interface{} `json:"payload"` // Message payload to send
+
+	Sequence uint64 `json:"sequence,omitempty"` // Set by the hub on each event, increasing on every message
+	Epoch    string `json:"epoch,omitempty"`    // Hub that set the sequence, sequences of other hubs or processes are not comparable
+}
+
+// Payload of messages sent by a user to another one, wrapped so users can not send server events
+type UserMessage struct {
+	SenderId string      `json:"sender_id"` // User who sent the message, taken from his token
+	Type     string      `json:"type"`      // Type chosen by the sender
+	Payload  interface{} `json:"payload"`
 }
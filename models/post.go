@@ -8,3 +8,9 @@ type Post struct {
 	CreatedAt time.Time `json:"created_at"`
 	UserId    string    `json:"user_id"`
 }
+
+// Reference to a post that does not exist anymore
+type DeletedPost struct {
+	Id     string `json:"id"`
+	UserId string `json:"user_id"`
+}
@@ -0,0 +1,5 @@
+package models
+
+type PresencePayload struct {
+	UserId string `json:"user_id"` // User that connected or disconnected
+}
@@ -0,0 +1,6 @@
+package models
+
+type ResumePayload struct {
+	LastSequence uint64 `json:"last_sequence"`   // Sequence of the last message received by the client
+	Epoch        string `json:"epoch,omitempty"` // Epoch of that message, empty for clients that did not receive any
+}
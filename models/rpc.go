@@ -0,0 +1,24 @@
+package models
+
+import "encoding/json"
+
+// JSON-RPC 2.0 request, notifications do not have id and do not receive response
+type RPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`          // Always '2.0'
+	Method  string          `json:"method"`           // Method to call like 'post.get'
+	Params  json.RawMessage `json:"params,omitempty"` // Params of the method, decoded by each method
+	Id      json.RawMessage `json:"id,omitempty"`     // Number or string sent back on the response, nil for notifications
+}
+
+// JSON-RPC 2.0 response, it has result or error but never both
+type RPCResponse struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Result  interface{} `json:"result,omitempty"`
+	Error   *RPCError   `json:"error,omitempty"`
+	Id      interface{} `json:"id"` // String or number of the request, null if it could not be read
+}
+
+type RPCError struct {
+	Code    int    `json:"code"`    // Standard codes from -32768 to -32000, our own codes are between -32099 and -32000
+	Message string `json:"message"` // Short description of the error
+}
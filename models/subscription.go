@@ -0,0 +1,5 @@
+package models
+
+type SubscriptionPayload struct {
+	Topic string `json:"topic"` // Name of the topic to subscribe or unsubscribe like 'posts' or 'post:<id>'
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Opaque token to get new access tokens, only his hash is stored.
+// Every token got by refreshing belongs to the family of the token created on login
+type RefreshToken struct {
+	Id        string     `json:"id"`
+	FamilyId  string     `json:"family_id"` // Id of the first token of the family
+	UserId    string     `json:"user_id"`
+	TokenHash string     `json:"-"` // SHA-256 of the token sent to the client
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`    // Token was exchanged for a new one, using it again means it was stolen
+	RevokedAt *time.Time `json:"revoked_at"` // Token can not be used anymore
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,6 @@
+package models
+
+type TypingPayload struct {
+	PostId string `json:"post_id"`           // Post the user is commenting
+	UserId string `json:"user_id,omitempty"` // User typing, set by the server
+}
@@ -13,9 +13,14 @@ type Repository interface {
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
 	InsertPost(ctx context.Context, user *models.Post) error
 	GetPostById(ctx context.Context, id string) (*models.Post, error)
-	UpdatePost(ctx context.Context, post *models.Post) error
-	DeletePost(ctx context.Context, id string, userId string) error
+	UpdatePost(ctx context.Context, post *models.Post) (int64, error)        // Returns rows affected
+	DeletePost(ctx context.Context, id string, userId string) (int64, error) // Returns rows affected
 	ListPost(ctx context.Context, page uint64) ([]*models.Post, error)
+	InsertRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	GetRefreshTokenByHash(ctx context.Context, hash string) (*models.RefreshToken, error)
+	UseRefreshToken(ctx context.Context, id string) (int64, error) // Returns rows affected
+	RevokeRefreshTokenFamily(ctx context.Context, familyId string) error
+	RevokeUserRefreshTokens(ctx context.Context, userId string) error
 	Close() error
 }
 
@@ -53,12 +58,12 @@ func GetPostById(ctx context.Context, id string) (*models.Post, error) {
 }
 
 // Function handle by the abstraction
-func UpdatePost(ctx context.Context, post *models.Post) error {
+func UpdatePost(ctx context.Context, post *models.Post) (int64, error) {
 	return implementation.UpdatePost(ctx, post)
 }
 
 // Function handle by the abstraction
-func DeletePost(ctx context.Context, id string, userId string) error {
+func DeletePost(ctx context.Context, id string, userId string) (int64, error) {
 	return implementation.DeletePost(ctx, id, userId)
 }
 
@@ -67,6 +72,31 @@ func ListPost(ctx context.Context, page uint64) ([]*models.Post, error) {
 	return implementation.ListPost(ctx, page)
 }
 
+// Function handle by the abstraction
+func InsertRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	return implementation.InsertRefreshToken(ctx, token)
+}
+
+// Function handle by the abstraction
+func GetRefreshTokenByHash(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	return implementation.GetRefreshTokenByHash(ctx, hash)
+}
+
+// Function handle by the abstraction
+func UseRefreshToken(ctx context.Context, id string) (int64, error) {
+	return implementation.UseRefreshToken(ctx, id)
+}
+
+// Function handle by the abstraction
+func RevokeRefreshTokenFamily(ctx context.Context, familyId string) error {
+	return implementation.RevokeRefreshTokenFamily(ctx, familyId)
+}
+
+// Function handle by the abstraction
+func RevokeUserRefreshTokens(ctx context.Context, userId string) error {
+	return implementation.RevokeUserRefreshTokens(ctx, userId)
+}
+
 // Function handle by the abstraction
 func Close() error {
 	return implementation.Close()
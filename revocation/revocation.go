@@ -0,0 +1,79 @@
+package revocation
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"hajduksanchez.com/go/rest-websockets/models"
+)
+
+// Store of tokens revoked before they expire, consulted every time a token is validated
+type Store interface {
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error     // Revoke a single token until it expires
+	RevokeUser(ctx context.Context, userId string, before time.Time) error // Revoke every token of the user issued until before
+	IsRevoked(ctx context.Context, claims *models.AppClaims) (bool, error)
+}
+
+// Store keeping revocations in memory, they are lost on restart and not shared between instances
+type MemoryStore struct {
+	tokens map[string]time.Time // Expiration of each revoked token, to forget it once it is expired anyway
+	users  map[string]time.Time // Tokens of each user issued until this time are revoked
+	mutex  *sync.RWMutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tokens: make(map[string]time.Time),
+		users:  make(map[string]time.Time),
+		mutex:  &sync.RWMutex{},
+	}
+}
+
+func (store *MemoryStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	// Forget tokens that can not be used anymore
+	now := time.Now()
+	for id, expiration := range store.tokens {
+		if expiration.Before(now) {
+			delete(store.tokens, id)
+		}
+	}
+	store.tokens[jti] = expiresAt
+	return nil
+}
+
+func (store *MemoryStore) RevokeUser(ctx context.Context, userId string, before time.Time) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.users[userId] = before
+	return nil
+}
+
+func (store *MemoryStore) IsRevoked(ctx context.Context, claims *models.AppClaims) (bool, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	if _, ok := store.tokens[claims.Id]; ok && claims.Id != "" {
+		return true, nil
+	}
+	before, ok := store.users[claims.UserId]
+	return ok && IssuedBefore(claims, before), nil
+}
+
+// Time the token was issued, with milliseconds unless it was issued before tokens had them
+func IssuedAt(claims *models.AppClaims) time.Time {
+	if claims.IssuedAtMs != 0 {
+		return time.UnixMilli(claims.IssuedAtMs)
+	}
+	return time.Unix(claims.IssuedAt, 0)
+}
+
+// Know if the token was issued until the time specified. Tokens without milliseconds issued on the same
+// second are revoked too
+func IssuedBefore(claims *models.AppClaims, before time.Time) bool {
+	return !IssuedAt(claims).After(before)
+}
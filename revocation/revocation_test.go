@@ -0,0 +1,103 @@
+package revocation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"hajduksanchez.com/go/rest-websockets/models"
+)
+
+// Claims of a token of the user issued at the time specified, without milliseconds like older tokens if legacy
+func claimsIssuedAt(userId string, jti string, issued time.Time, legacy bool) *models.AppClaims {
+	claims := &models.AppClaims{
+		UserId:         userId,
+		StandardClaims: jwt.StandardClaims{Id: jti, IssuedAt: issued.Unix()},
+	}
+	if !legacy {
+		claims.IssuedAtMs = issued.UnixMilli()
+	}
+	return claims
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	logout := time.Date(2026, 1, 1, 10, 0, 0, int(300*time.Millisecond), time.UTC) // Every token of 'user' revoked
+
+	store := NewMemoryStore()
+	if err := store.Revoke(ctx, "revoked", logout.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RevokeUser(ctx, "user", logout); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		claims  *models.AppClaims
+		revoked bool
+	}{
+		{name: "revoked token", claims: claimsIssuedAt("other", "revoked", logout.Add(time.Hour), false), revoked: true},
+		{name: "other token", claims: claimsIssuedAt("other", "valid", logout.Add(-time.Hour), false), revoked: false},
+		{name: "token without id", claims: claimsIssuedAt("other", "", logout.Add(-time.Hour), false), revoked: false},
+		{name: "issued before logging out everywhere", claims: claimsIssuedAt("user", "a", logout.Add(-time.Minute), false), revoked: true},
+		{name: "issued on the same millisecond", claims: claimsIssuedAt("user", "b", logout, false), revoked: true},
+		{name: "issued right after on the same second", claims: claimsIssuedAt("user", "c", logout.Add(100*time.Millisecond), false), revoked: false},
+		{name: "issued after", claims: claimsIssuedAt("user", "d", logout.Add(time.Minute), false), revoked: false},
+		{name: "older token on the same second", claims: claimsIssuedAt("user", "e", logout.Add(100*time.Millisecond), true), revoked: true},
+		{name: "older token on the next second", claims: claimsIssuedAt("user", "f", logout.Add(time.Second), true), revoked: false},
+		{name: "token of another user", claims: claimsIssuedAt("other", "g", logout.Add(-time.Minute), false), revoked: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			revoked, err := store.IsRevoked(ctx, test.claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if revoked != test.revoked {
+				t.Fatalf("expected revoked %v, got %v", test.revoked, revoked)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreForgetsExpiredTokens(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	if err := store.Revoke(ctx, "expired", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Revoke(ctx, "valid", time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := store.tokens["expired"]; ok {
+		t.Fatal("expected expired token to be forgotten")
+	}
+	if _, ok := store.tokens["valid"]; !ok {
+		t.Fatal("expected token to be revoked until it expires")
+	}
+}
+
+func TestMemoryStoreLogoutAgain(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	first := time.Now().Add(-time.Hour)
+	second := time.Now()
+
+	if err := store.RevokeUser(ctx, "user", first); err != nil {
+		t.Fatal(err)
+	}
+	between := claimsIssuedAt("user", "token", first.Add(time.Minute), false)
+	if revoked, _ := store.IsRevoked(ctx, between); revoked {
+		t.Fatal("expected token issued after the first logout to be valid")
+	}
+	if err := store.RevokeUser(ctx, "user", second); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, _ := store.IsRevoked(ctx, between); !revoked {
+		t.Fatal("expected token to be revoked by the second logout")
+	}
+}
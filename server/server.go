@@ -5,31 +5,105 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/golang-jwt/jwt"
 	"github.com/gorilla/mux"
 	"hajduksanchez.com/go/rest-websockets/database"
+	"hajduksanchez.com/go/rest-websockets/keys"
+	"hajduksanchez.com/go/rest-websockets/models"
 	"hajduksanchez.com/go/rest-websockets/repository"
+	"hajduksanchez.com/go/rest-websockets/revocation"
 
 	websocket "hajduksanchez.com/go/rest-websockets/websocket"
 )
 
+// Backplane available to share websocket messages between instances
+const PostgresBackplane string = "postgres"
+
+// Store of revoked tokens that can be used instead of the memory one
+const PostgresRevocationStore string = "postgres"
+
+// Time allowed to finish in-flight requests if it is not specified
+const DefaultShutdownTimeout time.Duration = 15 * time.Second
+
+// Lifetime of tokens if it is not specified
+const (
+	DefaultAccessTokenTTL  time.Duration = 15 * time.Minute
+	DefaultRefreshTokenTTL time.Duration = 30 * 24 * time.Hour
+)
+
+// Period to look for new signing keys if it is not specified
+const DefaultJWTKeysReload time.Duration = time.Minute
+
 // Configuration to connect our server
 type Config struct {
 	Port      string // Port to connect to
 	JWTSecret string // JWTSecret to connect to
 	DBUrl     string // DB URL to connect to
+
+	JWTKeysDir            string        // Directory with RSA or Ed25519 private keys to sign tokens, empty to sign with JWTSecret
+	JWTKeysReload         time.Duration // Period to look for new keys on the directory
+	JWTKeyActivationDelay time.Duration // Time a new key is published before signing with it, at least JWTKeysReload plus the JWKS cache
+
+	AccessTokenTTL  time.Duration // Lifetime of access tokens, short because they can not be revoked
+	RefreshTokenTTL time.Duration // Lifetime of refresh tokens, renewed every time they are used
+
+	WriteWait  time.Duration // Time allowed to write a message to a websocket client
+	PongWait   time.Duration // Time allowed to receive a pong from a websocket client before disconnect it
+	PingPeriod time.Duration // Period to send pings to websocket clients
+
+	PollTimeout time.Duration // Time a long polling request waits for new events
+
+	TypingThrottle time.Duration // Minimum time between typing indicators of the same user and post
+	TypingTimeout  time.Duration // Time without typing to tell others the user stopped typing
+
+	SendBufferSize     int    // Messages queued for each websocket client
+	ReplayBufferSize   int    // Last websocket events kept to resume sessions of reconnecting clients
+	SlowConsumerPolicy string // What to do when the queue of a websocket client is full (drop-oldest, drop-newest or disconnect)
+
+	Shards  int // Groups of websocket clients events are delivered to in parallel
+	Workers int // Routines delivering websocket events
+
+	EnableCompression    bool  // Compress websocket messages with permessage-deflate
+	CompressionLevel     int   // Deflate level from -2 to 9 for websocket messages
+	CompressionThreshold int   // Smaller websocket messages are sent uncompressed
+	MaxMessageSize       int64 // Max size in bytes of messages sent by websocket clients
+
+	MaxConnections        int  // Websocket connections accepted by the server, zero for no limit
+	MaxConnectionsPerUser int  // Websocket connections of the same user, zero for no limit
+	MaxConnectionsPerIP   int  // Websocket connections from the same IP address, zero for no limit
+	TrustProxy            bool // Take client IP address from X-Forwarded-For, only behind a proxy that sets it
+	MessageRate           int  // Messages per second a websocket client can send, zero for no limit
+	MessageBurst          int  // Messages a websocket client can send at once
+
+	AllowedOrigins []string // Sites allowed to open websocket connections, like 'app.example.com' or '*.example.com'
+	DevMode        bool     // Relax security checks for local development, like allowing any websocket origin
+
+	Backplane       string // Share websocket messages between instances, empty to run alone or 'postgres'
+	RevocationStore string // Where revoked tokens are kept, empty for memory when running alone or 'postgres'
+
+	ShutdownTimeout time.Duration // Time allowed to finish in-flight requests when the server stops
 }
 
 type Server interface {
-	Config() *Config     // Server configuration
-	Hub() *websocket.Hub // Hub configuration for websocket
+	Config() *Config                                                                  // Server configuration
+	Hub() *websocket.Hub                                                              // Hub configuration for websocket
+	Revocations() revocation.Store                                                    // Tokens revoked before they expire
+	Keys() *keys.KeySet                                                               // Keys to sign and verify tokens
+	ValidateToken(ctx context.Context, tokenString string) (*models.AppClaims, error) // Claims of a valid token not revoked
 }
 
 // / Broker is going to handle servers
 type Broker struct {
-	config *Config     // Properties to configure
-	router *mux.Router // Router to define API routes
-	hub    *websocket.Hub
+	config      *Config     // Properties to configure
+	router      *mux.Router // Router to define API routes
+	hub         *websocket.Hub
+	revocations revocation.Store // Tokens revoked before they expire
+	keys        *keys.KeySet     // Keys to sign and verify tokens
 }
 
 // Broker is no a server implementation
@@ -41,29 +115,129 @@ func (b *Broker) Hub() *websocket.Hub {
 	return b.hub
 }
 
+func (b *Broker) Revocations() revocation.Store {
+	return b.revocations
+}
+
+func (b *Broker) Keys() *keys.KeySet {
+	return b.keys
+}
+
 // Create a new server
 // [ctx] allow us to identify where is the problem (for example if we work in routines)
 func NewServer(ctx context.Context, config *Config) (*Broker, error) {
 	if config.Port == "" {
 		return nil, errors.New("port is not specified")
 	}
-	if config.JWTSecret == "" {
-		return nil, errors.New("JWTSecret is not specified")
+	if config.JWTSecret == "" && config.JWTKeysDir == "" {
+		return nil, errors.New("JWTSecret or JWTKeysDir is not specified")
 	}
 	if config.DBUrl == "" {
 		return nil, errors.New("DBUrl is not specified")
 	}
+	slowConsumerPolicy, err := websocket.ParseSlowConsumerPolicy(config.SlowConsumerPolicy)
+	if err != nil {
+		return nil, err
+	}
+	if config.Backplane != "" && config.Backplane != PostgresBackplane {
+		return nil, errors.New("unknown backplane " + config.Backplane)
+	}
+	if config.RevocationStore != "" && config.RevocationStore != PostgresRevocationStore {
+		return nil, errors.New("unknown revocation store " + config.RevocationStore)
+	}
+	if config.ShutdownTimeout <= 0 {
+		config.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	if config.AccessTokenTTL <= 0 {
+		config.AccessTokenTTL = DefaultAccessTokenTTL
+	}
+	if config.RefreshTokenTTL <= 0 {
+		config.RefreshTokenTTL = DefaultRefreshTokenTTL
+	}
+	if config.JWTKeysReload <= 0 {
+		config.JWTKeysReload = DefaultJWTKeysReload
+	}
+	// New keys are found on the next reload, and other services may keep the old ones until their cache expires
+	if minDelay := config.JWTKeysReload + keys.JWKSMaxAge; config.JWTKeyActivationDelay < minDelay {
+		config.JWTKeyActivationDelay = minDelay
+	}
+	signingKeys, err := keys.NewKeySet(config.JWTKeysDir, config.JWTSecret, config.JWTKeyActivationDelay)
+	if err != nil {
+		return nil, err
+	}
 
 	// If there is no error we create and return a new broker (server)
 	broker := &Broker{
-		config: config,
-		router: mux.NewRouter(),
-		hub:    websocket.NewHub(),
+		config:      config,
+		router:      mux.NewRouter(),
+		revocations: revocation.NewMemoryStore(), // Replaced on start if revocations are shared
+		keys:        signingKeys,
+	}
+	broker.hub, err = websocket.NewHub(&websocket.HubConfig{
+		WriteWait:  config.WriteWait,
+		PongWait:   config.PongWait,
+		PingPeriod: config.PingPeriod,
+
+		SendBufferSize:     config.SendBufferSize,
+		SlowConsumerPolicy: slowConsumerPolicy,
+		ReplayBufferSize:   config.ReplayBufferSize,
+		PollTimeout:        config.PollTimeout,
+		TypingThrottle:     config.TypingThrottle,
+		TypingTimeout:      config.TypingTimeout,
+		Shards:             config.Shards,
+		Workers:            config.Workers,
+
+		EnableCompression:    config.EnableCompression,
+		CompressionLevel:     config.CompressionLevel,
+		CompressionThreshold: config.CompressionThreshold,
+		MaxMessageSize:       config.MaxMessageSize,
+
+		MaxConnections:        config.MaxConnections,
+		MaxConnectionsPerUser: config.MaxConnectionsPerUser,
+		MaxConnectionsPerIP:   config.MaxConnectionsPerIP,
+		TrustProxy:            config.TrustProxy,
+		MessageRate:           config.MessageRate,
+		MessageBurst:          config.MessageBurst,
+
+		AllowedOrigins:  config.AllowedOrigins,
+		AllowAllOrigins: config.DevMode,
+
+		Authenticate: broker.ValidateToken, // Websocket clients use the same tokens as the API
+		IsRevoked:    broker.isRevoked,     // Calls of open connections are rejected after logout
+	})
+	if err != nil {
+		return nil, err
 	}
 	return broker, nil
 }
 
-// Start a new server instance
+// Validate token signed by this server and not revoked and return his claims
+func (b *Broker) ValidateToken(ctx context.Context, tokenString string) (*models.AppClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &models.AppClaims{}, b.keys.Keyfunc)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*models.AppClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	revoked, err := b.revocations.IsRevoked(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, errors.New("token revoked")
+	}
+	return claims, nil
+}
+
+// Know if the token was revoked, with the store used when the check is made because it is replaced on start
+func (b *Broker) isRevoked(ctx context.Context, claims *models.AppClaims) (bool, error) {
+	return b.revocations.IsRevoked(ctx, claims)
+}
+
+// Start a new server instance, it runs until SIGINT or SIGTERM is received
 func (b *Broker) Start(binder func(server Server, router *mux.Router)) {
 	b.router = mux.NewRouter()
 	binder(b, b.router)
@@ -73,14 +247,69 @@ func (b *Broker) Start(binder func(server Server, router *mux.Router)) {
 	if err != nil {
 		log.Fatal(err)
 	}
+	// Share websocket messages with other instances through the database
+	var backplane websocket.Backplane
+	if b.config.Backplane == PostgresBackplane {
+		backplane, err = repo.NewBackplane(database.BackplaneChannel)
+		if err != nil {
+			log.Fatal(err)
+		}
+		b.hub.SetBackplane(backplane)
+	}
+	// Share revoked tokens with other instances through the database
+	if b.config.RevocationStore == PostgresRevocationStore {
+		b.revocations = repo.NewRevocationStore()
+	}
+
+	// Pick up new signing keys without restarting, so they can be rotated
+	keysCtx, stopKeys := context.WithCancel(context.Background())
+	defer stopKeys()
+	go b.keys.Run(keysCtx, b.config.JWTKeysReload)
+
 	// Add new endpoint for handler connection of websocket
-	go b.hub.Run() // Start websocket new subroutine
+	hubCtx, stopHub := context.WithCancel(context.Background())
+	hubStopped := make(chan struct{})
+	go func() {
+		b.hub.Run(hubCtx) // Start websocket new subroutine
+		close(hubStopped)
+	}()
 
 	repository.SetRepository(repo)
 
 	// Start server
-	log.Println("Starting server on port", b.Config().Port)
-	if err := http.ListenAndServe(b.config.Port, b.router); err != nil {
-		log.Fatal("ListenAndServe: ", err) // If something goes wrong on HTTP initialization
+	httpServer := &http.Server{Addr: b.config.Port, Handler: b.router}
+	httpServer.RegisterOnShutdown(stopHub) // Event streams are regular requests, they end once the hub closes them
+	go func() {
+		log.Println("Starting server on port", b.Config().Port)
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("ListenAndServe: ", err) // If something goes wrong on HTTP initialization
+		}
+	}()
+
+	// Wait until the process is asked to stop, like on a new deploy
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	<-signalCtx.Done()
+	log.Println("Shutting down server")
+
+	// Stop accepting connections and wait for in-flight requests
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), b.config.ShutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Println("Error draining HTTP requests", err)
+	}
+
+	// Websockets are hijacked connections, so the hub closes them by itself
+	stopHub()
+	<-hubStopped
+
+	if backplane != nil {
+		if err := backplane.Close(); err != nil {
+			log.Println("Error closing backplane", err)
+		}
+	}
+	if err := repository.Close(); err != nil {
+		log.Println("Error closing repository", err)
 	}
+	log.Println("Server stopped")
 }
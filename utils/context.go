@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"hajduksanchez.com/go/rest-websockets/models"
+)
+
+// Key of the claims on the request context, unexported so only these helpers can set them
+type claimsContextKey struct{}
+
+var errUnauthenticated = errors.New("request is not authenticated")
+
+// Context with the claims of the authenticated user
+func WithClaims(ctx context.Context, claims *models.AppClaims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// Claims of the authenticated user, false if the context does not have them
+func ClaimsFromContext(ctx context.Context) (*models.AppClaims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*models.AppClaims)
+	return claims, ok && claims != nil
+}
+
+// Claims the auth middleware put on the request, or an error if it was not authenticated
+func ClaimsFromRequest(r *http.Request) (*models.AppClaims, error) {
+	claims, ok := ClaimsFromContext(r.Context())
+	if !ok {
+		return nil, errUnauthenticated
+	}
+	return claims, nil
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Get duration from an environment like '30s' or '1m', zero if it is not specified
+func GetEnvDuration(key string) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration on %s: %w", key, err)
+	}
+	return duration, nil
+}
+
+// Get integer from an environment, zero if it is not specified
+func GetEnvInt(key string) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number on %s: %w", key, err)
+	}
+	return number, nil
+}
+
+// Get boolean from an environment like 'true' or '1', false if it is not specified
+func GetEnvBool(key string) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return false, nil
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid boolean on %s: %w", key, err)
+	}
+	return enabled, nil
+}
+
+// Get list of values from an environment separated by commas, empty if it is not specified
+func GetEnvList(key string) []string {
+	values := make([]string, 0)
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
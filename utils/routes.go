@@ -2,12 +2,20 @@ package utils
 
 // List of endpoints
 const (
-	Home      string = "/"
-	Login     string = "/login"
-	Register  string = "/sign_up"
-	User      string = "/user"
-	Post      string = "/post"
-	PostId    string = "/post/{id}"
-	Posts     string = "/posts"
-	WebSocket string = "/web-socket"
+	Home         string = "/"
+	Login        string = "/login"
+	Register     string = "/sign_up"
+	RefreshToken string = "/token/refresh"
+	JWKS         string = "/.well-known/jwks.json"
+	Logout       string = "/logout"
+	LogoutAll    string = "/logout/all"
+	User         string = "/user"
+	UserMessages string = "/users/{id}/messages"
+	Post         string = "/post"
+	PostId       string = "/post/{id}"
+	Posts        string = "/posts"
+	Presence     string = "/presence"
+	WebSocket    string = "/web-socket"
+	Events       string = "/events"
+	Poll         string = "/poll"
 )
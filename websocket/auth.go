@@ -0,0 +1,87 @@
+package websocket
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// Subprotocol used by browsers to send the token, because they can not set headers on websocket connections.
+// The client asks for the protocols ['access_token', '<token>'] and the server selects 'access_token',
+// unless the client also asked for a codec like ['msgpack', 'access_token', '<token>']
+const TokenProtocol string = "access_token"
+
+// Query parameter to send the token like '/web-socket?token=<token>'
+const TokenQueryParameter string = "token"
+
+var (
+	errMissingToken = errors.New("missing authorization token")
+	errTokenRevoked = errors.New("token revoked")
+)
+
+// Get token sent on the upgrade request and the subprotocol to select if it was sent that way
+func tokenFromRequest(r *http.Request) (token string, protocol string, err error) {
+	// Same header used by the REST API
+	if token := strings.TrimSpace(r.Header.Get("Authorization")); token != "" {
+		return strings.TrimPrefix(token, "Bearer "), "", nil
+	}
+
+	// Token comes after the token protocol on the list of protocols
+	protocols := websocket.Subprotocols(r)
+	for i, protocol := range protocols {
+		if protocol == TokenProtocol && i+1 < len(protocols) {
+			return protocols[i+1], TokenProtocol, nil
+		}
+	}
+
+	if token := r.URL.Query().Get(TokenQueryParameter); token != "" {
+		return token, "", nil
+	}
+	return "", "", errMissingToken
+}
+
+// Check the token used to open the connection was not revoked since then, like on logout
+func (hub *Hub) checkRevoked(client *Client) error {
+	if hub.config.IsRevoked == nil {
+		return nil
+	}
+	revoked, err := hub.config.IsRevoked(client.ctx, client.Claims())
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return errTokenRevoked
+	}
+	return nil
+}
+
+// Close connections of the user on every instance, only the ones opened with the token specified if it is
+// not empty. Returns how many connections of this instance were closed
+func (hub *Hub) Disconnect(userId string, tokenId string) int {
+	closed := hub.disconnect(userId, tokenId)
+	hub.forward(event{Kind: disconnectEvent, Target: userId, TokenId: tokenId})
+	return closed
+}
+
+// Close connections of the user on this instance, only the ones opened with the token specified if it is not empty
+func (hub *Hub) disconnect(userId string, tokenId string) int {
+	clients := make([]*Client, 0)
+	for _, shard := range hub.shards {
+		shard.mutex.RLock()
+		for client := range shard.users[userId] {
+			if tokenId == "" || client.Claims().Id == tokenId {
+				clients = append(clients, client)
+			}
+		}
+		shard.mutex.RUnlock()
+	}
+
+	for _, client := range clients {
+		log.Println("Closing client", client.id, "of user", userId, "with revoked token")
+		client.kick(websocket.ClosePolicyViolation, errTokenRevoked.Error())
+	}
+	return len(clients)
+}
@@ -0,0 +1,130 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"hajduksanchez.com/go/rest-websockets/models"
+)
+
+// Claims of a valid token of the user with the id specified
+func tokenClaims(userId string, jti string) *models.AppClaims {
+	return &models.AppClaims{
+		UserId:         userId,
+		StandardClaims: jwt.StandardClaims{Id: jti, ExpiresAt: time.Now().Add(time.Minute).Unix()},
+	}
+}
+
+// Calls made with a revoked token are rejected even if the connection is still open
+func TestRPCRejectsRevokedTokens(t *testing.T) {
+	hub, err := NewHub(&HubConfig{
+		IsRevoked: func(ctx context.Context, claims *models.AppClaims) (bool, error) {
+			return claims.Id == "revoked", nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub.HandleRPC("echo", func(ctx context.Context, client *Client, params json.RawMessage) (interface{}, *models.RPCError) {
+		return "pong", nil
+	})
+
+	tests := []struct {
+		name string
+		jti  string
+		code int // Code of the error, 0 if the call succeeds
+	}{
+		{name: "valid token", jti: "valid", code: 0},
+		{name: "revoked token", jti: "revoked", code: RPCUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newClient(hub, "client", tokenClaims("user", test.jti), JSONCodec{}, "test")
+			hub.handleRPC(client, models.WebsocketMessage{
+				Type:    RPCMessage,
+				Payload: map[string]interface{}{"jsonrpc": rpcVersion, "method": "echo", "id": 1},
+			})
+
+			var reply models.WebsocketMessage
+			if err := client.codec.Unmarshal(<-client.outbound, &reply); err != nil {
+				t.Fatal(err)
+			}
+			var response rpcTestResponse
+			if err := DecodePayload(reply.Payload, &response); err != nil {
+				t.Fatal(err)
+			}
+			code := 0
+			if response.Error != nil {
+				code = response.Error.Code
+			}
+			if code != test.code {
+				t.Fatalf("expected error %d, got %+v", test.code, response)
+			}
+		})
+	}
+}
+
+// Logging out closes the connections opened with the token on every instance
+func TestDisconnectEveryInstance(t *testing.T) {
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	backplane := NewMemoryBackplane()
+	hubs := make([]*Hub, 2)
+	for i := range hubs {
+		hub, err := NewHub(&HubConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		hub.SetBackplane(backplane)
+		go hub.Run(ctx)
+		hubs[i] = hub
+	}
+
+	// Clients without socket, kicking them cancels their context like on event streams
+	clients := []struct {
+		hub    int
+		client *Client
+	}{
+		{hub: 0, client: newClient(hubs[0], "phone", tokenClaims("user", "first"), JSONCodec{}, "test")},
+		{hub: 0, client: newClient(hubs[0], "laptop", tokenClaims("user", "second"), JSONCodec{}, "test")},
+		{hub: 1, client: newClient(hubs[1], "tablet", tokenClaims("user", "first"), JSONCodec{}, "test")},
+		{hub: 1, client: newClient(hubs[1], "other", tokenClaims("other", "first"), JSONCodec{}, "test")},
+	}
+	for _, c := range clients {
+		hubs[c.hub].register <- c.client
+	}
+	for _, hub := range hubs {
+		// Hub handles one request at a time, so every client is registered
+		hub.handleSubscription(clients[0].client, models.WebsocketMessage{Type: SubscribeMessage, Payload: models.SubscriptionPayload{Topic: PostsTopic}})
+	}
+
+	closedClients := func() map[string]bool {
+		closed := make(map[string]bool)
+		for _, c := range clients {
+			select {
+			case <-c.client.ctx.Done():
+				closed[c.client.id] = true
+			default:
+			}
+		}
+		return closed
+	}
+
+	// Logout of a single token
+	if closed := hubs[0].Disconnect("user", "first"); closed != 1 {
+		t.Fatalf("expected 1 connection closed on this instance, got %d", closed)
+	}
+	if closed := closedClients(); len(closed) != 2 || !closed["phone"] || !closed["tablet"] {
+		t.Fatalf("expected connections of the token closed on every instance, got %v", closed)
+	}
+
+	// Logout everywhere
+	hubs[1].Disconnect("user", "")
+	if closed := closedClients(); len(closed) != 3 || !closed["laptop"] || closed["other"] {
+		t.Fatalf("expected every connection of the user closed, got %v", closed)
+	}
+}
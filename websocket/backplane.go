@@ -0,0 +1,102 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+)
+
+// Backplane shares messages between every instance of the server, so clients connected to
+// another instance behind the load balancer also receive them
+type Backplane interface {
+	Publish(ctx context.Context, data []byte) error // Send data to every instance
+	Subscribe(handler func(data []byte)) error      // Call handler with the data sent by any instance
+	Close() error
+}
+
+// Event as it travels through the backplane, each instance stamps his own sequence
+type envelope struct {
+	Origin string `json:"origin"` // Instance that sent the event
+	Event  event  `json:"event"`  // Event to deliver
+}
+
+// Use backplane to share messages with other instances, must be called before running the hub
+func (hub *Hub) SetBackplane(backplane Backplane) {
+	hub.backplane = backplane
+}
+
+// Send event delivered on this instance to the other ones
+func (hub *Hub) forward(e event) {
+	if hub.backplane == nil {
+		return
+	}
+
+	encoded, err := json.Marshal(envelope{Origin: hub.id, Event: e})
+	if err != nil {
+		log.Println("Error encoding backplane message", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hub.config.WriteWait)
+	defer cancel()
+	if err := hub.backplane.Publish(ctx, encoded); err != nil {
+		log.Println("Error publishing on backplane", err)
+	}
+}
+
+// Deliver event sent by another instance to the clients of this one
+func (hub *Hub) receive(data []byte) {
+	var message envelope
+	if err := json.Unmarshal(data, &message); err != nil {
+		log.Println("Error decoding backplane message", err)
+		return
+	}
+	if message.Origin == hub.id {
+		return // We already delivered it before publishing
+	}
+	if message.Event.Kind == disconnectEvent {
+		hub.disconnect(message.Event.Target, message.Event.TokenId)
+		return
+	}
+	hub.dispatch(message.Event, nil)
+}
+
+// Backplane connecting hubs running on the same process, useful for tests
+type MemoryBackplane struct {
+	handlers []func(data []byte) // Handlers of every subscribed hub
+	mutex    *sync.RWMutex
+}
+
+func NewMemoryBackplane() *MemoryBackplane {
+	return &MemoryBackplane{
+		handlers: make([]func(data []byte), 0),
+		mutex:    &sync.RWMutex{},
+	}
+}
+
+func (backplane *MemoryBackplane) Publish(ctx context.Context, data []byte) error {
+	backplane.mutex.RLock()
+	defer backplane.mutex.RUnlock()
+
+	for _, handler := range backplane.handlers {
+		handler(data)
+	}
+	return nil
+}
+
+func (backplane *MemoryBackplane) Subscribe(handler func(data []byte)) error {
+	backplane.mutex.Lock()
+	defer backplane.mutex.Unlock()
+
+	backplane.handlers = append(backplane.handlers, handler)
+	return nil
+}
+
+func (backplane *MemoryBackplane) Close() error {
+	backplane.mutex.Lock()
+	defer backplane.mutex.Unlock()
+
+	backplane.handlers = nil
+	return nil
+}
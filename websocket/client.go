@@ -1,31 +1,274 @@
 package websocket
 
-import "github.com/gorilla/websocket"
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"hajduksanchez.com/go/rest-websockets/models"
+)
 
 type Client struct {
-	hub      *Hub            // Hub of messages
-	id       string          // Client id
-	socket   *websocket.Conn // Socket connection for specific client
-	outbound chan []byte     // Channel to handle Messages to be send
+	hub      *Hub              // Hub of messages
+	id       string            // Client id, unique for each connection
+	claims   *models.AppClaims // Claims of the token used to connect
+	socket   *websocket.Conn   // Socket connection for specific client, nil for event streams
+	address  string            // Remote address of the connection
+	ip       string            // IP address counted for the connection limits
+	limiter  *tokenBucket      // Limit of messages sent by the client, nil for no limit
+	codec    Codec             // Format of the messages exchanged with the client
+	ctx      context.Context   // Cancelled when the client stops reading, used by calls made by the client
+	cancel   context.CancelFunc
+	outbound chan []byte    // Buffered channel to handle Messages to be send
+	closed   bool           // Outbound channel was closed and can not receive more messages
+	kicked   bool           // Client is being disconnected for being too slow
+	goodbye  []byte         // Close frame to send once outbound channel is closed
+	stopped  chan struct{}  // Closed when writing routine stops
+	dropped  *atomic.Uint64 // Messages dropped because outbound channel was full
+	mutex    *sync.Mutex    // To avoid sending messages to a closed outbound channel
+
+	topics        []string              // Topics to subscribe to as soon as the client is registered
+	resumeFrom    *models.ResumePayload // Last sequence received before reconnecting, missed events are sent on register
+	sentAfter     uint64                // Events after this sequence and up to lastSequence were queued, guarded by the mutex of the hub
+	lastSequence  uint64                // Sequence of the last event queued to the client, guarded by the mutex of the hub
+	subscriptions map[string]bool       // Topics the client is subscribed to, guarded by the mutex of his shard
+
+	typing      map[string]*typing // Posts the client is typing on
+	typingMutex *sync.Mutex        // Typing state changes with messages and expiry timers
+}
+
+func NewClient(hub *Hub, socket *websocket.Conn, id string, claims *models.AppClaims, codec Codec) *Client {
+	client := newClient(hub, id, claims, codec, socket.RemoteAddr().String())
+	client.socket = socket
+	client.limiter = newTokenBucket(hub.config.MessageRate, hub.config.MessageBurst)
+	return client
 }
 
-func NewClient(hub *Hub, socket *websocket.Conn) *Client {
+// Create a client without connection, the caller is in charge of delivering his messages
+func newClient(hub *Hub, id string, claims *models.AppClaims, codec Codec, address string) *Client {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Client{
 		hub:      hub,
-		socket:   socket,
-		outbound: make(chan []byte),
+		id:       id,
+		claims:   claims,
+		address:  address,
+		codec:    codec,
+		ctx:      ctx,
+		cancel:   cancel,
+		outbound: make(chan []byte, hub.config.SendBufferSize),
+		dropped:  &atomic.Uint64{},
+		stopped:  make(chan struct{}),
+		mutex:    &sync.Mutex{},
+
+		subscriptions: make(map[string]bool),
+
+		typing:      make(map[string]*typing),
+		typingMutex: &sync.Mutex{},
 	}
 }
 
+// Unique id of the connection
+func (client *Client) ID() string {
+	return client.id
+}
+
+// Id of the user authenticated on this connection
+func (client *Client) UserId() string {
+	return client.claims.UserId
+}
+
+// Claims of the token used to open the connection
+func (client *Client) Claims() *models.AppClaims {
+	return client.claims
+}
+
+// Number of messages this client did not receive because he was too slow
+func (client *Client) Dropped() uint64 {
+	return client.dropped.Load()
+}
+
+// Write messages to the client and keep connection alive sending pings periodically
 func (client *Client) Write() {
+	config := client.hub.config
+	ticker := time.NewTicker(config.PingPeriod)
+
+	defer func() {
+		ticker.Stop()
+		client.socket.Close() // Reading routine will fail and unregister the client
+		close(client.stopped)
+	}()
+
 	for {
 		select {
 		case message, ok := <-client.outbound:
+			client.socket.SetWriteDeadline(time.Now().Add(config.WriteWait))
 			if !ok {
-				client.socket.WriteMessage(websocket.CloseMessage, []byte{}) // If something wrong, send an error message
+				client.socket.WriteMessage(websocket.CloseMessage, client.goodbye) // Queued messages were sent, say goodbye
 				return
 			}
-			client.socket.WriteMessage(websocket.TextMessage, message)
+			client.socket.EnableWriteCompression(len(message) >= config.CompressionThreshold)
+			if err := client.socket.WriteMessage(client.codec.MessageType(), message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			client.socket.SetWriteDeadline(time.Now().Add(config.WriteWait))
+			if err := client.socket.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return // Client does not answer, connection is probably dead
+			}
+		}
+	}
+}
+
+// Read messages sent by the client and dispatch them to the hub handlers until the connection is closed
+func (client *Client) Read() {
+	// Any read error (or a close frame) means the client is gone, so the hub has to forget it
+	defer func() {
+		client.cancel() // Stop work requested by the client, nobody is going to read the result
+		select {
+		case client.hub.unregister <- client:
+		case <-client.hub.done: // Hub stopped and already closed every client
+		}
+	}()
+
+	// Client must answer our pings before the deadline, otherwise reading fails
+	pongWait := client.hub.config.PongWait
+	client.socket.SetReadDeadline(time.Now().Add(pongWait))
+	client.socket.SetPongHandler(func(string) error {
+		return client.socket.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := client.socket.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Println("Error reading from client", client.id, err)
+			}
+			return
+		}
+		if !client.limiter.allow() {
+			log.Println("Client", client.id, "exceeded the message rate")
+			rateLimitedClients.Add(1)
+			client.kick(websocket.ClosePolicyViolation, "too many messages")
+			return
+		}
+
+		var message models.WebsocketMessage
+		if err := client.codec.Unmarshal(data, &message); err != nil {
+			client.SendError("invalid message, expected " + client.codec.Name())
+			continue
+		}
+
+		handler, ok := client.hub.handler(message.Type)
+		if !ok {
+			client.SendError("unknown message type " + message.Type)
+			continue
 		}
+		handler(client, message)
+	}
+}
+
+// Send a message only to this client
+func (client *Client) Send(message models.WebsocketMessage) {
+	data, err := client.codec.Marshal(message)
+	if err != nil {
+		log.Println("Error encoding message for client", client.id, err)
+		return
+	}
+	client.send(data)
+}
+
+// Send an error message only to this client
+func (client *Client) SendError(description string) {
+	client.Send(models.WebsocketMessage{
+		Type:    ErrorMessage,
+		Payload: models.ErrorPayload{Message: description},
+	})
+}
+
+// Send data to outbound channel if client is still connected, without waiting for slow clients
+func (client *Client) send(data []byte) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if client.closed {
+		return
+	}
+	select {
+	case client.outbound <- data:
+		return
+	default: // Outbound channel is full, client is not reading fast enough
+	}
+
+	switch client.hub.config.SlowConsumerPolicy {
+	case DropOldest:
+		select {
+		case <-client.outbound: // Make room for the new message
+		default:
+		}
+		select {
+		case client.outbound <- data:
+		default:
+		}
+	case Disconnect:
+		if !client.kicked {
+			client.kicked = true
+			go client.kick(websocket.CloseTryAgainLater, "too slow reading messages")
+		}
+	}
+	client.dropped.Add(1)
+}
+
+// Send close frame and close the socket, reading routine will fail and unregister the client
+func (client *Client) kick(code int, reason string) {
+	if client.socket == nil {
+		client.cancel() // Event stream stops and unregisters the client
+		return
+	}
+	closeSocket(client.socket, code, reason, client.hub.config.WriteWait)
+}
+
+// Send close frame without waiting for queued messages and close the socket
+func closeSocket(socket *websocket.Conn, code int, reason string, writeWait time.Duration) {
+	deadline := time.Now().Add(writeWait)
+	socket.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+	socket.Close()
+}
+
+// Close the connection without waiting for queued messages
+func (client *Client) disconnect() {
+	client.cancel()
+	if client.socket != nil {
+		client.socket.Close()
+	}
+}
+
+// Close outbound channel to stop writing routine of the client
+func (client *Client) close() {
+	client.closeWith(websocket.CloseNormalClosure, "")
+}
+
+// Close outbound channel, writing routine sends queued messages and then a close frame with the code specified
+func (client *Client) closeWith(code int, reason string) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if client.closed {
+		return
+	}
+	client.closed = true
+	client.goodbye = websocket.FormatCloseMessage(code, reason)
+	close(client.outbound)
+}
+
+// Map a generic payload decoded from the socket into a specific struct, whatever codec the client uses
+func DecodePayload(payload interface{}, v interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
 	}
+	return json.Unmarshal(data, v)
 }
@@ -0,0 +1,113 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec encodes messages sent to clients and decodes messages received from them. Clients choose
+// it asking for his name as subprotocol like ['msgpack'], JSON is used if they do not ask for any
+type Codec interface {
+	Name() string                               // Subprotocol used to negotiate the codec
+	MessageType() int                           // Websocket frame used to send encoded messages (text or binary)
+	Marshal(v interface{}) ([]byte, error)      // Encode message to send it
+	Unmarshal(data []byte, v interface{}) error // Decode message received
+}
+
+// Codecs available, ordered by preference
+var codecs = []Codec{
+	JSONCodec{},
+	MessagePackCodec{},
+	CBORCodec{},
+}
+
+// Codec used when the client does not ask for any
+var DefaultCodec Codec = JSONCodec{}
+
+// Get the first codec asked by the client that we support
+func negotiateCodec(protocols []string) (Codec, bool) {
+	for _, protocol := range protocols {
+		for _, codec := range codecs {
+			if codec.Name() == protocol {
+				return codec, true
+			}
+		}
+	}
+	return DefaultCodec, false
+}
+
+// Messages encoded as JSON text frames
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string {
+	return "json"
+}
+
+func (JSONCodec) MessageType() int {
+	return websocket.TextMessage
+}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// Messages encoded as MessagePack binary frames, using the same field names as JSON
+type MessagePackCodec struct{}
+
+func (MessagePackCodec) Name() string {
+	return "msgpack"
+}
+
+func (MessagePackCodec) MessageType() int {
+	return websocket.BinaryMessage
+}
+
+func (MessagePackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := msgpack.NewEncoder(&buffer)
+	encoder.SetCustomStructTag("json")
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (MessagePackCodec) Unmarshal(data []byte, v interface{}) error {
+	decoder := msgpack.NewDecoder(bytes.NewReader(data))
+	decoder.SetCustomStructTag("json")
+	return decoder.Decode(v)
+}
+
+// CBOR modes using the same representation as JSON for maps and dates
+var (
+	cborEncoder, _ = cbor.EncOptions{Time: cbor.TimeRFC3339Nano}.EncMode()
+	cborDecoder, _ = cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]interface{}(nil))}.DecMode()
+)
+
+// Messages encoded as CBOR binary frames
+type CBORCodec struct{}
+
+func (CBORCodec) Name() string {
+	return "cbor"
+}
+
+func (CBORCodec) MessageType() int {
+	return websocket.BinaryMessage
+}
+
+func (CBORCodec) Marshal(v interface{}) ([]byte, error) {
+	return cborEncoder.Marshal(v)
+}
+
+func (CBORCodec) Unmarshal(data []byte, v interface{}) error {
+	return cborDecoder.Unmarshal(data, v)
+}
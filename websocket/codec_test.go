@@ -0,0 +1,112 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"hajduksanchez.com/go/rest-websockets/models"
+)
+
+// Messages sent by the hub reach the client with the same values whatever the codec
+func TestCodecsRoundTrip(t *testing.T) {
+	post := models.Post{
+		Id:        "post",
+		Content:   "Hello",
+		CreatedAt: time.Date(2026, 10, 18, 12, 30, 15, 123456789, time.UTC),
+		UserId:    "user",
+	}
+	sent := models.WebsocketMessage{Type: "Post-Created", Payload: post, Sequence: 42, Epoch: "epoch"}
+
+	for _, codec := range codecs {
+		t.Run(codec.Name(), func(t *testing.T) {
+			data, err := codec.Marshal(sent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var received models.WebsocketMessage
+			if err := codec.Unmarshal(data, &received); err != nil {
+				t.Fatal(err)
+			}
+			if received.Type != sent.Type || received.Sequence != sent.Sequence || received.Epoch != sent.Epoch {
+				t.Fatalf("expected %+v, got %+v", sent, received)
+			}
+
+			var payload models.Post
+			if err := DecodePayload(received.Payload, &payload); err != nil {
+				t.Fatal(err)
+			}
+			if payload.Id != post.Id || payload.Content != post.Content || payload.UserId != post.UserId {
+				t.Fatalf("expected %+v, got %+v", post, payload)
+			}
+			if !payload.CreatedAt.Equal(post.CreatedAt) {
+				t.Fatalf("expected created at %v, got %v", post.CreatedAt, payload.CreatedAt)
+			}
+		})
+	}
+}
+
+// Messages sent by clients are decoded with their codec and their payload read with DecodePayload
+func TestCodecsDecodeClientPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload interface{} // Payload as the client encodes it
+		topic   string
+		valid   bool
+	}{
+		{name: "subscription", payload: map[string]interface{}{"topic": PostsTopic}, topic: PostsTopic, valid: true},
+		{name: "subscription with unknown fields", payload: map[string]interface{}{"topic": "post:1", "other": 1}, topic: "post:1", valid: true},
+		{name: "topic of the wrong type", payload: map[string]interface{}{"topic": 1}, valid: false},
+		{name: "payload of the wrong type", payload: "posts", valid: false},
+	}
+
+	for _, codec := range codecs {
+		for _, test := range tests {
+			t.Run(codec.Name()+" "+test.name, func(t *testing.T) {
+				data, err := codec.Marshal(models.WebsocketMessage{Type: SubscribeMessage, Payload: test.payload})
+				if err != nil {
+					t.Fatal(err)
+				}
+				var message models.WebsocketMessage
+				if err := codec.Unmarshal(data, &message); err != nil {
+					t.Fatal(err)
+				}
+				if message.Type != SubscribeMessage {
+					t.Fatalf("expected type %s, got %s", SubscribeMessage, message.Type)
+				}
+
+				var payload models.SubscriptionPayload
+				err = DecodePayload(message.Payload, &payload)
+				if valid := err == nil; valid != test.valid {
+					t.Fatalf("expected valid %v, got error %v", test.valid, err)
+				}
+				if test.valid && payload.Topic != test.topic {
+					t.Fatalf("expected topic %s, got %s", test.topic, payload.Topic)
+				}
+			})
+		}
+	}
+}
+
+func TestNegotiateCodec(t *testing.T) {
+	tests := []struct {
+		name       string
+		protocols  []string
+		expected   string
+		negotiated bool
+	}{
+		{name: "no protocols", protocols: nil, expected: "json", negotiated: false},
+		{name: "token protocol only", protocols: []string{TokenProtocol, "token"}, expected: "json", negotiated: false},
+		{name: "msgpack", protocols: []string{"msgpack"}, expected: "msgpack", negotiated: true},
+		{name: "first supported of the client", protocols: []string{"unknown", "cbor", "msgpack"}, expected: "cbor", negotiated: true},
+		{name: "codec with token", protocols: []string{"msgpack", TokenProtocol, "token"}, expected: "msgpack", negotiated: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			codec, negotiated := negotiateCodec(test.protocols)
+			if codec.Name() != test.expected || negotiated != test.negotiated {
+				t.Fatalf("expected %s negotiated %v, got %s negotiated %v", test.expected, test.negotiated, codec.Name(), negotiated)
+			}
+		})
+	}
+}
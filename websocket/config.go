@@ -0,0 +1,150 @@
+package websocket
+
+import (
+	"compress/flate"
+	"context"
+	"fmt"
+	"runtime"
+	"time"
+
+	"hajduksanchez.com/go/rest-websockets/models"
+)
+
+// Default values used when the configuration does not specify them
+const (
+	DefaultWriteWait time.Duration = 10 * time.Second
+	DefaultPongWait  time.Duration = 60 * time.Second
+
+	DefaultPollTimeout time.Duration = 30 * time.Second // Less than the usual idle timeout of proxies
+
+	DefaultTypingThrottle time.Duration = 2 * time.Second
+	DefaultTypingTimeout  time.Duration = 5 * time.Second
+
+	DefaultSendBufferSize   int = 256
+	DefaultReplayBufferSize int = 1024
+
+	DefaultShards int = 32 // Enough for subscriptions to rarely wait for deliveries with thousands of connections
+
+	DefaultCompressionLevel     int   = 1         // Fastest compression, good enough for repetitive payloads
+	DefaultCompressionThreshold int   = 512       // Smaller messages are not worth compressing
+	DefaultMaxMessageSize       int64 = 64 * 1024 // Messages sent by clients are small, like subscriptions
+)
+
+// What to do with a new message when the client outbound channel is full
+type SlowConsumerPolicy string
+
+const (
+	DropOldest SlowConsumerPolicy = "drop-oldest" // Discard the oldest queued message to enqueue the new one
+	DropNewest SlowConsumerPolicy = "drop-newest" // Discard the new message
+	Disconnect SlowConsumerPolicy = "disconnect"  // Discard the new message and disconnect the client
+)
+
+// Get policy from his name, drop oldest is used by default
+func ParseSlowConsumerPolicy(value string) (SlowConsumerPolicy, error) {
+	switch policy := SlowConsumerPolicy(value); policy {
+	case "":
+		return DropOldest, nil
+	case DropOldest, DropNewest, Disconnect:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown slow consumer policy %q", value)
+	}
+}
+
+// Configuration to handle websocket connections of the hub
+type HubConfig struct {
+	WriteWait  time.Duration // Time allowed to write a message to the client
+	PongWait   time.Duration // Time allowed to receive the next pong from the client before disconnect it
+	PingPeriod time.Duration // Period to send pings to the client, must be less than PongWait
+
+	PollTimeout time.Duration // Time a long polling request waits for new events before returning none
+
+	TypingThrottle time.Duration // Minimum time between typing messages relayed for the same user and post
+	TypingTimeout  time.Duration // Time without typing messages to tell subscribers the user stopped typing
+
+	SendBufferSize     int                // Messages queued for each client before applying the slow consumer policy
+	SlowConsumerPolicy SlowConsumerPolicy // What to do when the queue of a client is full
+	ReplayBufferSize   int                // Last events kept to be sent again to reconnecting clients
+
+	Shards  int // Groups of clients events are delivered to in parallel
+	Workers int // Routines delivering events to the shards, one for each CPU by default
+
+	EnableCompression    bool  // Negotiate permessage-deflate with clients that support it
+	CompressionLevel     int   // Deflate level from -2 (huffman only) to 9 (best compression), zero uses the default
+	CompressionThreshold int   // Messages smaller than this number of bytes are sent uncompressed
+	MaxMessageSize       int64 // Bigger messages sent by clients close their connection
+
+	MaxConnections        int  // Connections accepted by the hub, zero for no limit
+	MaxConnectionsPerUser int  // Connections of the same user, zero for no limit
+	MaxConnectionsPerIP   int  // Connections from the same IP address, zero for no limit
+	TrustProxy            bool // Take the IP address from X-Forwarded-For, only behind a proxy that sets it
+	MessageRate           int  // Messages per second a client can send, zero for no limit
+	MessageBurst          int  // Messages a client can send at once, one second of messages by default
+
+	AllowedOrigins  []string // Hosts allowed to open connections from a browser, like 'app.example.com' or '*.example.com'
+	AllowAllOrigins bool     // Allow any origin, only for development
+
+	// Validate token sent on the upgrade request and return his claims
+	Authenticate func(ctx context.Context, tokenString string) (*models.AppClaims, error)
+	// Know if the token of an open connection was revoked, checked on every call. Connections are closed with
+	// Disconnect when tokens are revoked. Nil if tokens can not be revoked
+	IsRevoked func(ctx context.Context, claims *models.AppClaims) (bool, error)
+}
+
+// Fill empty values of the configuration with default ones
+func (config HubConfig) withDefaults() HubConfig {
+	if config.WriteWait <= 0 {
+		config.WriteWait = DefaultWriteWait
+	}
+	if config.PongWait <= 0 {
+		config.PongWait = DefaultPongWait
+	}
+	if config.PingPeriod <= 0 || config.PingPeriod >= config.PongWait {
+		config.PingPeriod = config.PongWait * 9 / 10 // Ping before the client reaches pong deadline
+	}
+	if config.PollTimeout <= 0 {
+		config.PollTimeout = DefaultPollTimeout
+	}
+	if config.TypingThrottle <= 0 {
+		config.TypingThrottle = DefaultTypingThrottle
+	}
+	if config.TypingTimeout <= 0 {
+		config.TypingTimeout = DefaultTypingTimeout
+	}
+	if config.SendBufferSize <= 0 {
+		config.SendBufferSize = DefaultSendBufferSize
+	}
+	if config.ReplayBufferSize <= 0 {
+		config.ReplayBufferSize = DefaultReplayBufferSize
+	}
+	if config.Shards <= 0 {
+		config.Shards = DefaultShards
+	}
+	if config.Workers <= 0 {
+		config.Workers = runtime.GOMAXPROCS(0)
+	}
+	if config.SlowConsumerPolicy == "" {
+		config.SlowConsumerPolicy = DropOldest
+	}
+	if config.CompressionLevel == 0 {
+		config.CompressionLevel = DefaultCompressionLevel
+	}
+	if config.CompressionThreshold <= 0 {
+		config.CompressionThreshold = DefaultCompressionThreshold
+	}
+	if config.MaxMessageSize <= 0 {
+		config.MaxMessageSize = DefaultMaxMessageSize
+	}
+	if config.MessageBurst <= 0 {
+		config.MessageBurst = config.MessageRate
+	}
+	return config
+}
+
+// Validate values that can not be replaced by default ones
+func (config HubConfig) validate() error {
+	if config.CompressionLevel < flate.HuffmanOnly || config.CompressionLevel > flate.BestCompression {
+		return fmt.Errorf("invalid compression level %d", config.CompressionLevel)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package websocket
+
+import (
+	"strings"
+
+	"hajduksanchez.com/go/rest-websockets/models"
+)
+
+// Types of messages a client can send or receive through the socket
+const (
+	SubscribeMessage   string = "subscribe"
+	UnsubscribeMessage string = "unsubscribe"
+	ResumeMessage      string = "resume"
+	ErrorMessage       string = "error"
+
+	ResyncRequiredMessage string = "resync-required" // Client missed too many events and must get the data again
+)
+
+// Function in charge of handling a specific type of message sent by a client
+type MessageHandler func(client *Client, message models.WebsocketMessage)
+
+// Register handler for every message of the type specified sent by clients
+func (hub *Hub) HandleMessage(messageType string, handler MessageHandler) {
+	hub.handlersMutex.Lock()
+	defer hub.handlersMutex.Unlock()
+
+	hub.handlers[messageType] = handler
+}
+
+// Get handler registered for a message type
+func (hub *Hub) handler(messageType string) (MessageHandler, bool) {
+	hub.handlersMutex.RLock()
+	defer hub.handlersMutex.RUnlock()
+
+	handler, ok := hub.handlers[messageType]
+	return handler, ok
+}
+
+// Handle 'subscribe' and 'unsubscribe' messages sent by clients
+func (hub *Hub) handleSubscription(client *Client, message models.WebsocketMessage) {
+	var payload models.SubscriptionPayload
+	if err := DecodePayload(message.Payload, &payload); err != nil || payload.Topic == "" {
+		client.SendError("invalid subscription")
+		return
+	}
+	if !canSubscribe(client.UserId(), payload.Topic) {
+		client.SendError("not allowed to subscribe to " + payload.Topic)
+		return
+	}
+
+	subscription := &subscription{client: client, topic: payload.Topic, done: make(chan struct{})}
+	channel := hub.subscribe
+	if message.Type == UnsubscribeMessage {
+		channel = hub.unsubscribe
+	}
+	select {
+	case channel <- subscription:
+	case <-hub.done:
+		return // Hub stopped, client is being disconnected
+	}
+	<-subscription.done // Next messages of the client, like 'resume', already see the subscription
+}
+
+// Know if the user is allowed to listen the topic
+func canSubscribe(userId string, topic string) bool {
+	// Events of a user are private, nobody else can listen them
+	return !strings.HasPrefix(topic, UserTopic("")) || topic == UserTopic(userId)
+}
+
+// Handle 'resume' messages sent by reconnecting clients with the last sequence they received
+func (hub *Hub) handleResume(client *Client, message models.WebsocketMessage) {
+	var payload models.ResumePayload
+	if err := DecodePayload(message.Payload, &payload); err != nil {
+		client.SendError("invalid resume")
+		return
+	}
+	hub.resume(client, payload)
+}
@@ -1,102 +1,432 @@
 package websocket
 
 import (
-	"encoding/json"
+	"context"
 	"log"
 	"net/http"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/segmentio/ksuid"
+	"hajduksanchez.com/go/rest-websockets/models"
 )
 
-// Used to allow HTTP connection to use websocket
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true }, // Allow everyone to connect
-}
-
 type Hub struct {
-	clients    []*Client    // Clients to handle
-	register   chan *Client // Channel to handle new client connection
-	unregister chan *Client // Channel to handle client disconnect
-	mutex      *sync.Mutex  // To avoid race conditions in our Hub
+	id          string             // Instance id, to ignore our own messages coming from the backplane
+	config      HubConfig          // Configuration of websocket connections
+	upgrader    websocket.Upgrader // Used to allow HTTP connection to use websocket
+	backplane   Backplane          // Share messages with other instances, nil when running alone
+	shards      []*shard           // Clients to handle, split to deliver to them in parallel
+	deliveries  chan delivery      // Events to deliver to each shard, read by the workers
+	register    chan *Client       // Channel to handle new client connection
+	unregister  chan *Client       // Channel to handle client disconnect
+	subscribe   chan *subscription // Channel to handle client subscription to a topic
+	unsubscribe chan *subscription // Channel to handle client unsubscription from a topic
+	presence    map[string]int     // Open connections of each online user
+	connections *connectionCount   // Open connections to enforce the limits
+	sequence    uint64             // Sequence of the last event delivered
+	replay      *replayBuffer      // Last events delivered, to resume sessions
+	updated     chan struct{}      // Closed and replaced on every event, to wake up long polling requests
+	mutex       *sync.Mutex        // Orders events, and guards presence and the replay buffer
+	done        chan struct{}      // Closed when the hub stops running
+
+	handlers      map[string]MessageHandler // Handlers for each type of message sent by clients
+	rpcMethods    map[string]RPCMethod      // Methods clients can call with JSON-RPC
+	handlersMutex *sync.RWMutex             // To register handlers while clients are reading
 }
 
 // Create a new HUB
-func NewHub() *Hub {
-	return &Hub{
-		clients:    make([]*Client, 0),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		mutex:      &sync.Mutex{},
+func NewHub(config *HubConfig) (*Hub, error) {
+	hubConfig := config.withDefaults()
+	if err := hubConfig.validate(); err != nil {
+		return nil, err
+	}
+
+	hub := &Hub{
+		id:          ksuid.New().String(),
+		config:      hubConfig,
+		shards:      make([]*shard, hubConfig.Shards),
+		deliveries:  make(chan delivery, hubConfig.Shards),
+		register:    make(chan *Client),
+		unregister:  make(chan *Client),
+		subscribe:   make(chan *subscription),
+		unsubscribe: make(chan *subscription),
+		presence:    make(map[string]int),
+		connections: newConnectionCount(),
+		replay:      newReplayBuffer(hubConfig.ReplayBufferSize),
+		updated:     make(chan struct{}),
+		mutex:       &sync.Mutex{},
+		done:        make(chan struct{}),
+
+		handlers:      make(map[string]MessageHandler),
+		rpcMethods:    make(map[string]RPCMethod),
+		handlersMutex: &sync.RWMutex{},
 	}
+	hub.upgrader = websocket.Upgrader{
+		CheckOrigin:       hub.checkOrigin, // Only allowed sites can connect
+		EnableCompression: hubConfig.EnableCompression,
+	}
+
+	for i := range hub.shards {
+		hub.shards[i] = newShard()
+	}
+	for i := 0; i < hubConfig.Workers; i++ {
+		go hub.work()
+	}
+
+	// Default handlers for the messages every client can send
+	hub.HandleMessage(SubscribeMessage, hub.handleSubscription)
+	hub.HandleMessage(UnsubscribeMessage, hub.handleSubscription)
+	hub.HandleMessage(ResumeMessage, hub.handleResume)
+	hub.HandleMessage(RPCMessage, hub.handleRPC)
+	hub.HandleMessage(TypingMessage, hub.handleTyping)
+	hub.HandleMessage(TypingStoppedMessage, hub.handleTyping)
+
+	return hub, nil
 }
 
+// Authenticate the request and upgrade it to a websocket connection
 func (hub *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	socket, err := upgrader.Upgrade(w, r, nil) // Update socket connection
+	tokenString, protocol, err := tokenFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	claims, err := hub.config.Authenticate(r.Context(), tokenString)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// Topics and last event received can be sent on the URL, so missed events are sent before any new one
+	topics := r.URL.Query()[TopicQueryParameter]
+	for _, topic := range topics {
+		if !canSubscribe(claims.UserId, topic) {
+			http.Error(w, "not allowed to subscribe to "+topic, http.StatusForbidden)
+			return
+		}
+	}
+	resumeFrom, err := resumeFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Generate an unique ID for this connection, the same user can have many of them
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Browsers can not read the status of a failed upgrade, so limits are sent as close frames
+	address := hub.clientAddress(r)
+	limitErr := hub.reserveConnection(claims.UserId, address)
+
+	// Browsers require the server to select one of the protocols they asked for
+	codec, negotiated := negotiateCodec(websocket.Subprotocols(r))
+	if negotiated {
+		protocol = codec.Name()
+	}
+	var responseHeader http.Header
+	if protocol != "" {
+		responseHeader = http.Header{"Sec-Websocket-Protocol": {protocol}}
+	}
 
+	socket, err := hub.upgrader.Upgrade(w, r, responseHeader) // Update socket connection
 	if err != nil {
-		log.Println(err)
-		http.Error(w, "Couldn't upgrade socket", http.StatusBadRequest)
+		log.Println(err) // Upgrader already replied to the client with the error
+		if limitErr == nil {
+			hub.releaseConnection(claims.UserId, address)
+		}
+		return
+	}
+	if limitErr != nil {
+		log.Println("Rejected websocket connection of user", claims.UserId, "from", address, limitErr)
+		rejectedConnections.Add(1)
+		closeSocket(socket, limitErr.code, limitErr.reason, hub.config.WriteWait)
+		return
+	}
+	socket.SetReadLimit(hub.config.MaxMessageSize)
+	if hub.config.EnableCompression {
+		socket.SetCompressionLevel(hub.config.CompressionLevel) // Only used if the client supports compression
 	}
 
-	client := NewClient(hub, socket)
-	hub.register <- client // Send Client to register channel
+	client := NewClient(hub, socket, id.String(), claims, codec)
+	client.ip = address
+	client.topics = topics
+	client.resumeFrom = resumeFrom
+	select {
+	case hub.register <- client: // Send Client to register channel
+	case <-hub.done:
+		hub.releaseConnection(claims.UserId, address)
+		client.kick(websocket.CloseGoingAway, "server shutting down")
+		return
+	}
 
 	go client.Write() // New routine in charge of sending messages to client
+	go client.Read()  // New routine in charge of reading messages from client
 }
 
-func (hub *Hub) Run() {
+// Handle clients until the context is done, then close every connection and stop
+func (hub *Hub) Run(ctx context.Context) {
+	// Deliver messages sent by other instances to our clients
+	if hub.backplane != nil {
+		if err := hub.backplane.Subscribe(hub.receive); err != nil {
+			log.Println("Error subscribing to backplane", err)
+		}
+	}
+
 	for {
 		select {
+		case <-ctx.Done():
+			close(hub.done) // Nobody waits for the hub anymore
+			hub.shutdown()
+			return
 		case client := <-hub.register:
 			hub.onConnect(client)
 		case client := <-hub.unregister:
 			hub.onDisconnect(client)
+		case subscription := <-hub.subscribe:
+			hub.onSubscribe(subscription)
+			close(subscription.done)
+		case subscription := <-hub.unsubscribe:
+			hub.onUnsubscribe(subscription)
+			close(subscription.done)
+		}
+	}
+}
+
+// Close every connection with a going away frame, waiting a bit for frames to be sent
+func (hub *Hub) shutdown() {
+	hub.mutex.Lock()
+	clients := make([]*Client, 0)
+	for _, shard := range hub.shards {
+		clients = append(clients, shard.removeAll()...)
+	}
+	hub.presence = make(map[string]int)
+	hub.mutex.Unlock()
+
+	log.Println("Closing", len(clients), "websocket clients")
+	for _, client := range clients {
+		hub.releaseConnection(client.UserId(), client.ip)
+		client.closeWith(websocket.CloseGoingAway, "server shutting down")
+	}
+
+	timeout := time.After(hub.config.WriteWait)
+	for _, client := range clients {
+		select {
+		case <-client.stopped:
+		case <-timeout:
+			return // Clients too slow to receive the close frame, we are leaving anyway
 		}
 	}
 }
 
 // Show client connects and his Address
 func (hub *Hub) onConnect(client *Client) {
-	log.Println("Client connected", client.socket.RemoteAddr())
+	log.Println("Client connected", client.id, "user", client.UserId(), client.address)
 
 	// Lock hub to handle user connection before accept another connection
 	hub.mutex.Lock()
-	// Unlock hub at the end of connection
-	defer hub.mutex.Unlock()
+	hub.shardOf(client).add(client) // Add client with his initial topics
+	client.sentAfter = hub.sequence // Older events were never sent on this connection
+	// Nothing can be delivered in between, so the client receives every event exactly once
+	if client.resumeFrom != nil {
+		hub.replayTo(client, *client.resumeFrom)
+	}
+	online := hub.addPresence(client.UserId())
+	hub.mutex.Unlock()
 
-	client.id = client.socket.RemoteAddr().String() // Client ID is his address connection
-	hub.clients = append(hub.clients, client)       // Add new client to slice
+	if online {
+		hub.announcePresence(UserOnlineMessage, client.UserId())
+	}
 }
 
 func (hub *Hub) onDisconnect(client *Client) {
-	log.Println("Client disconnect", client.socket.RemoteAddr())
+	log.Println("Client disconnect", client.id, "user", client.UserId(), client.address)
 
 	// Close client connection
-	client.socket.Close()
+	client.disconnect()
+
+	if !hub.removeClient(client) {
+		return // Client was already removed
+	}
+	hub.releaseConnection(client.UserId(), client.ip)
+	if dropped := client.Dropped(); dropped > 0 {
+		log.Println("Client", client.id, "dropped", dropped, "messages")
+	}
+	client.close() // Stop writing routine of the client
+
+	// Client is not going to type anymore
+	for _, postId := range client.stopTypingAll() {
+		hub.relayTyping(client, TypingStoppedMessage, postId)
+	}
+
+	if hub.removePresence(client.UserId()) {
+		hub.announcePresence(UserOfflineMessage, client.UserId())
+	}
+}
+
+// Remove client from the hub and his topics, false if he was not registered
+func (hub *Hub) removeClient(client *Client) bool {
+	return hub.shardOf(client).remove(client)
+}
+
+// Add client to the list of subscribers of a topic
+func (hub *Hub) onSubscribe(subscription *subscription) {
+	shard := hub.shardOf(subscription.client)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	shard.subscribe(subscription.client, subscription.topic)
+}
+
+// Remove client from the list of subscribers of a topic
+func (hub *Hub) onUnsubscribe(subscription *subscription) {
+	shard := hub.shardOf(subscription.client)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	shard.unsubscribe(subscription.client, subscription.topic)
+}
+
+// Message send to every client except for ignoreClient specified, on every instance of the server
+func (hub *Hub) Broadcast(message models.WebsocketMessage, ignoreClient *Client) {
+	e := event{Kind: broadcastEvent, Message: message}
+	hub.dispatch(e, ignoreClient)
+	hub.forward(e)
+}
+
+// Message send only to clients subscribed to the topic specified, on every instance of the server
+func (hub *Hub) Publish(topic string, message models.WebsocketMessage) {
+	e := event{Kind: topicEvent, Target: topic, Message: message}
+	hub.dispatch(e, nil)
+	hub.forward(e)
+}
+
+// Message send to every connection of the user specified on every instance of the server,
+// returns how many connections of this instance received it
+func (hub *Hub) SendToUser(userId string, message models.WebsocketMessage) int {
+	e := event{Kind: userEvent, Target: userId, Message: message}
+	delivered := hub.dispatch(e, nil)
+	hub.forward(e)
+	return delivered
+}
+
+// Message send only to clients subscribed to the topic specified except for ignoreClient, on every instance
+// of the server. It is not stored, so clients connecting later or resuming never receive it
+func (hub *Hub) Relay(topic string, message models.WebsocketMessage, ignoreClient *Client) {
+	e := event{Kind: topicEvent, Target: topic, Message: message, Ephemeral: true}
+	hub.dispatch(e, ignoreClient)
+	hub.forward(e)
+}
 
-	// Lock channel to disconnect client before other clients disconnect
+// Stamp event with the next sequence, store it to be replayed and send it to the clients of
+// this instance that should receive it. Returns how many clients received it
+func (hub *Hub) dispatch(e event, ignoreClient *Client) int {
+	if e.Ephemeral {
+		return hub.deliver(e, ignoreClient) // Order does not matter for events that are not stored
+	}
+
+	// Lock while delivering so every client receives events ordered by sequence
 	hub.mutex.Lock()
 	defer hub.mutex.Unlock()
 
-	i := -1
-	for index, clientData := range hub.clients {
-		if clientData.id == client.id {
-			i = index // Client index on slice
+	hub.sequence++
+	e.Message.Sequence = hub.sequence
+	e.Message.Epoch = hub.id // Sequences restart on every process and each instance has his own
+	hub.replay.add(e)
+	close(hub.updated) // Long polling requests read the new event from the replay buffer
+	hub.updated = make(chan struct{})
+
+	return hub.deliver(e, ignoreClient)
+}
+
+// Send event to the clients of every shard that should receive it
+func (hub *Hub) deliver(e event, ignoreClient *Client) int {
+	// Shards deliver in parallel, encoding message once for each codec used by the clients
+	encoded := newEncodings(e.Message)
+	delivered := &atomic.Int64{}
+	wg := &sync.WaitGroup{}
+	wg.Add(len(hub.shards))
+	for _, shard := range hub.shards {
+		hub.deliveries <- delivery{
+			shard:     shard,
+			event:     e,
+			ignore:    ignoreClient,
+			encoded:   encoded,
+			delivered: delivered,
+			wg:        wg,
 		}
 	}
+	wg.Wait()
+	return int(delivered.Load())
+}
+
+// Send again events the client missed since the sequence specified, or ask him to resync if
+// they are not available anymore. Events queued since he connected are not sent again, but the
+// missed ones arrive after them. Clients sending 'since' and 'epoch' on the URL instead receive
+// them before anything else
+func (hub *Hub) resume(client *Client, from models.ResumePayload) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
 
-	copy(hub.clients[i:], hub.clients[i+1:])       // Copy without this specific entry (i)
-	hub.clients[len(hub.clients)-1] = nil          // Last position on slice will be set to nil
-	hub.clients = hub.clients[:len(hub.clients)-1] // New slice without last position
+	hub.replayTo(client, from)
 }
 
-// Message send to every client except for ignoreClient specified
-func (hub *Hub) Broadcast(message interface{}, ignoreClient *Client) {
-	data, _ := json.Marshal(message)
-	for _, client := range hub.clients {
-		if client != ignoreClient {
-			client.outbound <- data // Send message to outbound channel to send message to each client
+// Send events the client missed since the sequence specified, hub must be locked
+func (hub *Hub) replayTo(client *Client, from models.ResumePayload) {
+	shard := hub.shardOf(client)
+	shard.mutex.RLock()
+	missed, ok := hub.eventsSince(from.Epoch, from.LastSequence, func(e event) bool {
+		// Events queued live since he connected are not sent twice
+		queued := e.Message.Sequence > client.sentAfter && e.Message.Sequence <= client.lastSequence
+		return !queued && shard.shouldReceive(client, e)
+	})
+	shard.mutex.RUnlock()
+	if !ok {
+		client.Send(hub.resyncMessage())
+		return
+	}
+	// Client queue is not big enough to receive everything he missed
+	if len(missed) > hub.config.SendBufferSize {
+		client.Send(hub.resyncMessage())
+		return
+	}
+	for _, message := range missed {
+		client.Send(message)
+	}
+	client.sentAfter, client.lastSequence = 0, hub.sequence // Client has every event he should receive
+}
+
+// Messages of the events after the sequence specified accepted by the filter, false if they are not
+// available anymore or the sequence was set by another hub. Hub must be locked
+func (hub *Hub) eventsSince(epoch string, sequence uint64, filter func(e event) bool) ([]models.WebsocketMessage, bool) {
+	// Clients that did not receive anything yet have no epoch, any other one must be ours
+	if epoch != hub.id && (epoch != "" || sequence != 0) {
+		return nil, false
+	}
+	events, ok := hub.replay.since(sequence)
+	if !ok || sequence > hub.sequence {
+		return nil, false
+	}
+
+	messages := make([]models.WebsocketMessage, 0)
+	for _, e := range events {
+		if filter(e) {
+			messages = append(messages, e.Message)
 		}
 	}
+	return messages, true
+}
+
+// Message asking the client to get the data again from the API, hub must be locked
+func (hub *Hub) resyncMessage() models.WebsocketMessage {
+	return models.WebsocketMessage{
+		Type:    ResyncRequiredMessage,
+		Payload: models.ResumePayload{LastSequence: hub.sequence, Epoch: hub.id},
+	}
 }
@@ -0,0 +1,136 @@
+package websocket
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Connections of the hub, to enforce the connection limits of the configuration
+type connectionCount struct {
+	total     int            // Connections of every user
+	users     map[string]int // Connections of each user
+	addresses map[string]int // Connections from each IP address
+	mutex     *sync.Mutex
+}
+
+// Connection rejected because it exceeds a limit
+type limitError struct {
+	code   int    // Close code sent to websocket clients
+	status int    // Status sent to HTTP clients, like event streams
+	reason string // Sent to the client and logged
+}
+
+func (err *limitError) Error() string {
+	return err.reason
+}
+
+func newConnectionCount() *connectionCount {
+	return &connectionCount{
+		users:     make(map[string]int),
+		addresses: make(map[string]int),
+		mutex:     &sync.Mutex{},
+	}
+}
+
+// Count a new connection of the user from the address, unless it exceeds a limit
+func (hub *Hub) reserveConnection(userId string, address string) *limitError {
+	count := hub.connections
+	count.mutex.Lock()
+	defer count.mutex.Unlock()
+
+	config := hub.config
+	if config.MaxConnections > 0 && count.total >= config.MaxConnections {
+		// Server is full, it is not the fault of the client
+		return &limitError{code: websocket.CloseTryAgainLater, status: http.StatusServiceUnavailable, reason: "too many connections"}
+	}
+	if config.MaxConnectionsPerUser > 0 && count.users[userId] >= config.MaxConnectionsPerUser {
+		return &limitError{code: websocket.ClosePolicyViolation, status: http.StatusTooManyRequests, reason: "too many connections of the user"}
+	}
+	if config.MaxConnectionsPerIP > 0 && count.addresses[address] >= config.MaxConnectionsPerIP {
+		return &limitError{code: websocket.ClosePolicyViolation, status: http.StatusTooManyRequests, reason: "too many connections from the address"}
+	}
+
+	count.total++
+	count.users[userId]++
+	count.addresses[address]++
+	return nil
+}
+
+// Discount a connection reserved before
+func (hub *Hub) releaseConnection(userId string, address string) {
+	count := hub.connections
+	count.mutex.Lock()
+	defer count.mutex.Unlock()
+
+	count.total--
+	if count.users[userId]--; count.users[userId] <= 0 {
+		delete(count.users, userId)
+	}
+	if count.addresses[address]--; count.addresses[address] <= 0 {
+		delete(count.addresses, address)
+	}
+}
+
+// IP address of the client. Behind a trusted proxy it is the last one of X-Forwarded-For, added by
+// the proxy, because previous ones can be forged by the client
+func (hub *Hub) clientAddress(r *http.Request) string {
+	if hub.config.TrustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			addresses := strings.Split(forwarded, ",")
+			return strings.TrimSpace(addresses[len(addresses)-1])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Limit of messages a client can send, refilled with rate tokens per second up to burst tokens.
+// It is only used by the reading routine of the client, so it does not need a mutex
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// Create a full bucket, nil if there is no rate so every message is allowed
+func newTokenBucket(rate int, burst int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	return &tokenBucket{
+		rate:   float64(rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Take a token if there is one available
+func (bucket *tokenBucket) allow() bool {
+	if bucket == nil {
+		return true
+	}
+
+	now := time.Now()
+	bucket.tokens += now.Sub(bucket.last).Seconds() * bucket.rate
+	if bucket.tokens > bucket.burst {
+		bucket.tokens = bucket.burst
+	}
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
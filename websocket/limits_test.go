@@ -0,0 +1,64 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucketAllow(t *testing.T) {
+	tests := []struct {
+		name     string
+		rate     int
+		burst    int
+		tokens   float64       // Tokens left before waiting
+		elapsed  time.Duration // Time since the last message
+		attempts int
+		allowed  int
+	}{
+		{name: "unlimited", rate: 0, burst: 0, attempts: 100, allowed: 100},
+		{name: "full bucket allows a burst", rate: 1, burst: 5, tokens: 5, attempts: 10, allowed: 5},
+		{name: "empty bucket", rate: 1, burst: 5, tokens: 0, attempts: 3, allowed: 0},
+		{name: "refills with the rate", rate: 10, burst: 5, tokens: 0, elapsed: 300 * time.Millisecond, attempts: 10, allowed: 3},
+		{name: "partial tokens are kept", rate: 2, burst: 5, tokens: 0.5, elapsed: 250 * time.Millisecond, attempts: 3, allowed: 1},
+		{name: "less than a token", rate: 2, burst: 5, tokens: 0, elapsed: 400 * time.Millisecond, attempts: 3, allowed: 0},
+		{name: "refill stops at the burst", rate: 10, burst: 5, tokens: 0, elapsed: time.Minute, attempts: 10, allowed: 5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bucket := newTokenBucket(test.rate, test.burst)
+			if bucket != nil {
+				bucket.tokens = test.tokens
+				bucket.last = time.Now().Add(-test.elapsed)
+			}
+
+			allowed := 0
+			for i := 0; i < test.attempts; i++ {
+				if bucket.allow() {
+					allowed++
+				}
+			}
+			if allowed != test.allowed {
+				t.Fatalf("expected %d messages allowed, got %d", test.allowed, allowed)
+			}
+		})
+	}
+}
+
+func TestTokenBucketRefillsOverTime(t *testing.T) {
+	bucket := newTokenBucket(10, 1)
+	if !bucket.allow() {
+		t.Fatal("expected the first message to be allowed")
+	}
+	if bucket.allow() {
+		t.Fatal("expected the bucket to be empty")
+	}
+
+	time.Sleep(300 * time.Millisecond) // Several tokens at this rate, but only one fits
+	if !bucket.allow() {
+		t.Fatal("expected the bucket to be refilled")
+	}
+	if bucket.allow() {
+		t.Fatal("expected the refill to stop at the burst")
+	}
+}
@@ -0,0 +1,10 @@
+package websocket
+
+import "expvar"
+
+// Counters published on expvar, shared by every hub of the process
+var (
+	rejectedOrigins     = expvar.NewInt("websocket_rejected_origins")     // Upgrades rejected by origin
+	rejectedConnections = expvar.NewInt("websocket_rejected_connections") // Connections rejected by the connection limits
+	rateLimitedClients  = expvar.NewInt("websocket_rate_limited_clients") // Clients disconnected for sending too many messages
+)
@@ -0,0 +1,52 @@
+package websocket
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Validate origin of the upgrade request, so other sites can not open connections using the
+// credentials of our users. Allowed origins are hosts like 'app.example.com', 'localhost:3000'
+// or wildcard subdomains like '*.example.com'
+func (hub *Hub) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || hub.config.AllowAllOrigins {
+		return true // Only browsers send the origin, other clients are authenticated by token
+	}
+
+	originUrl, err := url.Parse(origin)
+	if err == nil && hub.isAllowedOrigin(originUrl, r.Host) {
+		return true
+	}
+
+	log.Println("Rejected websocket origin", origin, "from", r.RemoteAddr)
+	rejectedOrigins.Add(1)
+	return false
+}
+
+// Know if origin matches the allowlist, or the host of the request if there is no allowlist
+func (hub *Hub) isAllowedOrigin(origin *url.URL, requestHost string) bool {
+	if len(hub.config.AllowedOrigins) == 0 {
+		return strings.EqualFold(origin.Host, requestHost) // Same origin only
+	}
+
+	for _, allowed := range hub.config.AllowedOrigins {
+		allowed = strings.ToLower(allowed)
+		// Hosts with port must match the port too
+		host := strings.ToLower(origin.Hostname())
+		if strings.Contains(allowed, ":") {
+			host = strings.ToLower(origin.Host)
+		}
+
+		if wildcard := strings.TrimPrefix(allowed, "*"); wildcard != allowed {
+			if strings.HasSuffix(host, wildcard) {
+				return true // Any subdomain like 'app.example.com' for '*.example.com'
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package websocket
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		name     string
+		allowed  []string
+		allowAll bool
+		origin   string
+		host     string
+		expected bool
+	}{
+		{name: "no origin header", allowed: []string{"app.example.com"}, origin: "", host: "api.example.com", expected: true},
+		{name: "same origin without allowlist", origin: "https://api.example.com", host: "api.example.com", expected: true},
+		{name: "other origin without allowlist", origin: "https://evil.com", host: "api.example.com", expected: false},
+		{name: "allow all origins", allowAll: true, origin: "https://evil.com", host: "api.example.com", expected: true},
+		{name: "exact host", allowed: []string{"app.example.com"}, origin: "https://app.example.com", expected: true},
+		{name: "exact host ignores case", allowed: []string{"App.Example.com"}, origin: "https://APP.example.COM", expected: true},
+		{name: "exact host on any port", allowed: []string{"app.example.com"}, origin: "http://app.example.com:3000", expected: true},
+		{name: "other host", allowed: []string{"app.example.com"}, origin: "https://admin.example.com", expected: false},
+		{name: "host as prefix", allowed: []string{"app.example.com"}, origin: "https://app.example.com.evil.com", expected: false},
+		{name: "wildcard subdomain", allowed: []string{"*.example.com"}, origin: "https://app.example.com", expected: true},
+		{name: "wildcard nested subdomain", allowed: []string{"*.example.com"}, origin: "https://a.b.example.com", expected: true},
+		{name: "wildcard does not match suffix of other domain", allowed: []string{"*.example.com"}, origin: "https://evilexample.com", expected: false},
+		{name: "wildcard does not match the domain itself", allowed: []string{"*.example.com"}, origin: "https://example.com", expected: false},
+		{name: "host with port", allowed: []string{"localhost:3000"}, origin: "http://localhost:3000", expected: true},
+		{name: "host with other port", allowed: []string{"localhost:3000"}, origin: "http://localhost:4000", expected: false},
+		{name: "host with port without port", allowed: []string{"localhost:3000"}, origin: "http://localhost", expected: false},
+		{name: "wildcard with port", allowed: []string{"*.example.com:8443"}, origin: "https://app.example.com:8443", expected: true},
+		{name: "wildcard with other port", allowed: []string{"*.example.com:8443"}, origin: "https://app.example.com", expected: false},
+		{name: "any of the list", allowed: []string{"a.com", "b.com"}, origin: "https://b.com", expected: true},
+		{name: "invalid origin", allowed: []string{"app.example.com"}, origin: "://bad", expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hub, err := NewHub(&HubConfig{AllowedOrigins: test.allowed, AllowAllOrigins: test.allowAll})
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest("GET", "/web-socket", nil)
+			r.Host = test.host
+			if test.origin != "" {
+				r.Header.Set("Origin", test.origin)
+			}
+
+			if allowed := hub.checkOrigin(r); allowed != test.expected {
+				t.Fatalf("expected %v for origin %q, got %v", test.expected, test.origin, allowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"hajduksanchez.com/go/rest-websockets/models"
+)
+
+// Query parameters with the last sequence received and his epoch like '/poll?since=<sequence>&epoch=<epoch>'
+const (
+	SinceQueryParameter string = "since"
+	EpochQueryParameter string = "epoch"
+)
+
+// Wait until there are events after the sequence specified, or the poll timeout expires, and return them as a
+// JSON array. Clients send the sequence and epoch of the last message received on the next request, and
+// start from 0 without epoch
+func (hub *Hub) HandlePoll(w http.ResponseWriter, r *http.Request) {
+	tokenString, _, err := tokenFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	claims, err := hub.config.Authenticate(r.Context(), tokenString)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	from, err := resumeFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if from == nil {
+		from = &models.ResumePayload{} // First request, every event still available
+	}
+
+	// Same topics a websocket client could subscribe to
+	topics := make(map[string]bool)
+	for _, topic := range r.URL.Query()[TopicQueryParameter] {
+		if !canSubscribe(claims.UserId, topic) {
+			http.Error(w, "not allowed to subscribe to "+topic, http.StatusForbidden)
+			return
+		}
+		topics[topic] = true
+	}
+	filter := func(e event) bool {
+		switch e.Kind {
+		case topicEvent:
+			return topics[e.Target]
+		case userEvent:
+			return claims.UserId == e.Target
+		default:
+			return true
+		}
+	}
+
+	timeout := time.NewTimer(hub.config.PollTimeout)
+	defer timeout.Stop()
+
+	for {
+		hub.mutex.Lock()
+		messages, ok := hub.eventsSince(from.Epoch, from.LastSequence, filter)
+		if !ok {
+			messages = append(messages, hub.resyncMessage()) // Client must get the data again and poll since the new sequence and epoch
+		}
+		updated := hub.updated
+		hub.mutex.Unlock()
+
+		if len(messages) > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(messages)
+			return
+		}
+
+		select {
+		case <-updated: // New event, it may be one the client is interested in
+		case <-timeout.C:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(messages) // Nothing new, client polls again with the same sequence
+			return
+		case <-hub.done:
+			http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+			return
+		case <-r.Context().Done():
+			return // Client went away
+		}
+	}
+}
+
+// Last sequence and epoch received sent with the query parameters, nil if the client did not send them
+func resumeFromQuery(r *http.Request) (*models.ResumePayload, error) {
+	query := r.URL.Query()
+	sinceString, epoch := query.Get(SinceQueryParameter), query.Get(EpochQueryParameter)
+	if sinceString == "" && epoch == "" {
+		return nil, nil
+	}
+
+	from := &models.ResumePayload{Epoch: epoch}
+	if sinceString != "" {
+		since, err := strconv.ParseUint(sinceString, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid " + SinceQueryParameter)
+		}
+		from.LastSequence = since
+	}
+	return from, nil
+}
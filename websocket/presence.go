@@ -0,0 +1,61 @@
+package websocket
+
+import (
+	"sort"
+
+	"hajduksanchez.com/go/rest-websockets/models"
+)
+
+// Types of messages sent when users connect or disconnect. Presence is counted on each instance, so they
+// are only sent to the clients of the instance the user connected to
+const (
+	UserOnlineMessage  string = "User-Online"
+	UserOfflineMessage string = "User-Offline"
+)
+
+// Count a new connection of the user, true if it is his first one. Hub must be locked
+func (hub *Hub) addPresence(userId string) bool {
+	hub.presence[userId]++
+	return hub.presence[userId] == 1
+}
+
+// Discount a connection of the user, true if it was his last one
+func (hub *Hub) removePresence(userId string) bool {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	hub.presence[userId]--
+	if hub.presence[userId] > 0 {
+		return false
+	}
+	delete(hub.presence, userId)
+	return true
+}
+
+// Ids of the users with at least one open connection on this instance, users connected only to other
+// instances are not included
+func (hub *Hub) OnlineUsers() []string {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	users := make([]string, 0, len(hub.presence))
+	for userId := range hub.presence {
+		users = append(users, userId)
+	}
+	sort.Strings(users)
+	return users
+}
+
+// Tell the clients of this instance the user is online or offline. It is not forwarded through the backplane,
+// because a user leaving this instance may still be connected to another one
+func (hub *Hub) announcePresence(messageType string, userId string) {
+	hub.dispatch(event{Kind: broadcastEvent, Message: presenceMessage(messageType, userId)}, nil)
+}
+
+// Message telling everyone a user is online or offline
+func presenceMessage(messageType string, userId string) models.WebsocketMessage {
+	return models.WebsocketMessage{
+		Type:    messageType,
+		Payload: models.PresencePayload{UserId: userId},
+	}
+}
@@ -0,0 +1,96 @@
+package websocket
+
+import (
+	"context"
+	"testing"
+
+	"hajduksanchez.com/go/rest-websockets/models"
+)
+
+// Types of the messages queued to the client with the user of their presence payload, like 'User-Online user'
+func queuedPresence(t *testing.T, client *Client) []string {
+	messages := make([]string, 0)
+	for {
+		select {
+		case data := <-client.outbound:
+			var message models.WebsocketMessage
+			if err := client.codec.Unmarshal(data, &message); err != nil {
+				t.Fatal(err)
+			}
+			var payload models.PresencePayload
+			if err := DecodePayload(message.Payload, &payload); err != nil {
+				t.Fatal(err)
+			}
+			messages = append(messages, message.Type+" "+payload.UserId)
+		default:
+			return messages
+		}
+	}
+}
+
+// A user leaving an instance may still be connected to another one, so presence is not shared
+func TestPresenceStaysOnItsInstance(t *testing.T) {
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	backplane := NewMemoryBackplane()
+	hubs := make([]*Hub, 2)
+	observers := make([]*Client, 2)
+	for i := range hubs {
+		hub, err := NewHub(&HubConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		hub.SetBackplane(backplane)
+		go hub.Run(ctx)
+		hubs[i] = hub
+
+		observers[i] = newClient(hub, "observer", &models.AppClaims{UserId: "observer"}, JSONCodec{}, "test")
+		hub.register <- observers[i]
+	}
+	// Hub handles one request at a time, so the last request sent to it already finished
+	wait := func(hub *Hub) {
+		hub.handleSubscription(observers[0], models.WebsocketMessage{Type: SubscribeMessage, Payload: models.SubscriptionPayload{Topic: PostsTopic}})
+	}
+	for i, hub := range hubs {
+		wait(hub)
+		queuedPresence(t, observers[i]) // Forget the presence of the observers
+	}
+
+	// Same user connected to both instances, he leaves the first one
+	first := newClient(hubs[0], "first", &models.AppClaims{UserId: "user"}, JSONCodec{}, "test")
+	second := newClient(hubs[1], "second", &models.AppClaims{UserId: "user"}, JSONCodec{}, "test")
+	hubs[0].register <- first
+	hubs[1].register <- second
+	hubs[0].unregister <- first
+	wait(hubs[0])
+	wait(hubs[1])
+
+	expected := [][]string{
+		{UserOnlineMessage + " user", UserOfflineMessage + " user"},
+		{UserOnlineMessage + " user"},
+	}
+	for i := range hubs {
+		messages := queuedPresence(t, observers[i])
+		if len(messages) != len(expected[i]) {
+			t.Fatalf("instance %d: expected %v, got %v", i, expected[i], messages)
+		}
+		for j := range messages {
+			if messages[j] != expected[i][j] {
+				t.Fatalf("instance %d: expected %v, got %v", i, expected[i], messages)
+			}
+		}
+	}
+
+	if online := hubs[1].OnlineUsers(); len(online) != 2 || online[1] != "user" {
+		t.Fatalf("expected user online on the second instance, got %v", online)
+	}
+
+	// Other events are still shared
+	hubs[0].Broadcast(models.WebsocketMessage{Type: "test"}, nil)
+	select {
+	case <-observers[1].outbound:
+	default:
+		t.Fatal("expected broadcast to reach the other instance")
+	}
+}
@@ -0,0 +1,66 @@
+package websocket
+
+import "hajduksanchez.com/go/rest-websockets/models"
+
+// Kinds of delivery of an event
+const (
+	broadcastEvent  string = "broadcast"  // Every client
+	topicEvent      string = "topic"      // Clients subscribed to a topic
+	userEvent       string = "user"       // Connections of a user
+	disconnectEvent string = "disconnect" // Close connections of a user, only sent through the backplane
+)
+
+// Message delivered by the hub and who should receive it
+type event struct {
+	Kind    string                  `json:"kind"`             // Kind of delivery (broadcast, topic or user)
+	Target  string                  `json:"target,omitempty"` // Topic or user id, depending on the kind of delivery
+	Message models.WebsocketMessage `json:"message"`          // Message to deliver
+
+	Ephemeral bool   `json:"ephemeral,omitempty"` // Delivered only to connected clients, without sequence nor replay
+	TokenId   string `json:"tokenId,omitempty"`   // Token whose connections are closed by disconnect events, empty for all
+}
+
+// Fixed size ring buffer with the last events delivered, so reconnecting clients can get what they missed
+type replayBuffer struct {
+	events []event // Events ordered by sequence, starting on 'start' position
+	start  int     // Position of the oldest event
+	count  int     // Number of events stored
+}
+
+func newReplayBuffer(size int) *replayBuffer {
+	return &replayBuffer{
+		events: make([]event, size),
+	}
+}
+
+// Store event, overwriting the oldest one if buffer is full
+func (buffer *replayBuffer) add(e event) {
+	if buffer.count < len(buffer.events) {
+		buffer.events[(buffer.start+buffer.count)%len(buffer.events)] = e
+		buffer.count++
+		return
+	}
+	buffer.events[buffer.start] = e
+	buffer.start = (buffer.start + 1) % len(buffer.events)
+}
+
+// Events with sequence greater than the one specified, false if some of them are not stored anymore
+func (buffer *replayBuffer) since(sequence uint64) ([]event, bool) {
+	if buffer.count == 0 {
+		return nil, true
+	}
+
+	oldest := buffer.events[buffer.start].Message.Sequence
+	if sequence+1 < oldest {
+		return nil, false // Client missed events that were already overwritten
+	}
+
+	events := make([]event, 0)
+	for i := 0; i < buffer.count; i++ {
+		e := buffer.events[(buffer.start+i)%len(buffer.events)]
+		if e.Message.Sequence > sequence {
+			events = append(events, e)
+		}
+	}
+	return events, true
+}
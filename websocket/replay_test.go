@@ -0,0 +1,230 @@
+package websocket
+
+import (
+	"context"
+	"testing"
+
+	"hajduksanchez.com/go/rest-websockets/models"
+)
+
+// Replay buffer of the size specified with events stamped from 1 to count
+func replayBufferWith(size int, count int) *replayBuffer {
+	buffer := newReplayBuffer(size)
+	for sequence := 1; sequence <= count; sequence++ {
+		buffer.add(event{Message: models.WebsocketMessage{Sequence: uint64(sequence)}})
+	}
+	return buffer
+}
+
+func sequencesOf(events []event) []uint64 {
+	sequences := make([]uint64, 0, len(events))
+	for _, e := range events {
+		sequences = append(sequences, e.Message.Sequence)
+	}
+	return sequences
+}
+
+func TestReplayBufferSince(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		count    int
+		since    uint64
+		expected []uint64
+		ok       bool
+	}{
+		{name: "empty buffer", size: 3, count: 0, since: 0, expected: []uint64{}, ok: true},
+		{name: "from the start", size: 3, count: 2, since: 0, expected: []uint64{1, 2}, ok: true},
+		{name: "up to date", size: 3, count: 2, since: 2, expected: []uint64{}, ok: true},
+		{name: "full buffer", size: 3, count: 3, since: 1, expected: []uint64{2, 3}, ok: true},
+		{name: "wrapped buffer keeps order", size: 3, count: 5, since: 3, expected: []uint64{4, 5}, ok: true},
+		{name: "wrapped buffer from the oldest", size: 3, count: 5, since: 2, expected: []uint64{3, 4, 5}, ok: true},
+		{name: "oldest event overwritten", size: 3, count: 5, since: 1, ok: false},
+		{name: "wrapped many times", size: 3, count: 10, since: 0, ok: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events, ok := replayBufferWith(test.size, test.count).since(test.since)
+			if ok != test.ok {
+				t.Fatalf("expected ok %v, got %v", test.ok, ok)
+			}
+			if !ok {
+				return
+			}
+			sequences := sequencesOf(events)
+			if len(sequences) != len(test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, sequences)
+			}
+			for i := range sequences {
+				if sequences[i] != test.expected[i] {
+					t.Fatalf("expected %v, got %v", test.expected, sequences)
+				}
+			}
+		})
+	}
+}
+
+func TestEventsSinceEpoch(t *testing.T) {
+	previous, err := NewHub(&HubConfig{ReplayBufferSize: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub, err := NewHub(&HubConfig{ReplayBufferSize: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 600; i++ {
+		hub.Broadcast(models.WebsocketMessage{Type: "test"}, nil)
+	}
+
+	tests := []struct {
+		name     string
+		epoch    string
+		since    uint64
+		expected int
+		ok       bool
+	}{
+		{name: "same epoch", epoch: hub.id, since: 500, expected: 100, ok: true},
+		{name: "new client", epoch: "", since: 0, expected: 600, ok: true},
+		{name: "previous process", epoch: previous.id, since: 500, ok: false},
+		{name: "sequence without epoch", epoch: "", since: 500, ok: false},
+		{name: "sequence ahead of the hub", epoch: hub.id, since: 601, ok: false},
+	}
+
+	all := func(e event) bool { return true }
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hub.mutex.Lock()
+			messages, ok := hub.eventsSince(test.epoch, test.since, all)
+			hub.mutex.Unlock()
+
+			if ok != test.ok {
+				t.Fatalf("expected ok %v, got %v", test.ok, ok)
+			}
+			if len(messages) != test.expected {
+				t.Fatalf("expected %d messages, got %d", test.expected, len(messages))
+			}
+			for _, message := range messages {
+				if message.Epoch != hub.id || message.Sequence <= test.since {
+					t.Fatalf("unexpected message %+v", message)
+				}
+			}
+		})
+	}
+}
+
+// Sequences of the events queued to the client, in the order he receives them
+func queuedSequences(t *testing.T, client *Client) []uint64 {
+	sequences := make([]uint64, 0)
+	for {
+		select {
+		case data := <-client.outbound:
+			var message models.WebsocketMessage
+			if err := client.codec.Unmarshal(data, &message); err != nil {
+				t.Fatal(err)
+			}
+			if message.Sequence != 0 {
+				sequences = append(sequences, message.Sequence)
+			}
+		default:
+			return sequences
+		}
+	}
+}
+
+// Clients receive every event once, and in order when they resume on the URL. Connecting broadcasts
+// the user is online, which takes a sequence too
+func TestResumeWithoutDuplicates(t *testing.T) {
+	subscribe := models.WebsocketMessage{Type: SubscribeMessage, Payload: models.SubscriptionPayload{Topic: PostsTopic}}
+
+	tests := []struct {
+		name     string
+		connect  func(hub *Hub, client *Client) // Register the client after the first two events are published
+		resume   *models.ResumePayload          // Sent as 'resume' message once connected
+		expected []uint64
+	}{
+		{
+			name: "resume message after live events",
+			connect: func(hub *Hub, client *Client) {
+				hub.register <- client
+				hub.handleSubscription(client, subscribe)
+				hub.Publish(PostsTopic, models.WebsocketMessage{Type: "post"})
+			},
+			resume:   &models.ResumePayload{LastSequence: 0},
+			expected: []uint64{3, 4, 1, 2, 5},
+		},
+		{
+			name: "resume message right after connecting",
+			connect: func(hub *Hub, client *Client) {
+				hub.register <- client
+				hub.handleSubscription(client, subscribe)
+			},
+			resume:   &models.ResumePayload{LastSequence: 1},
+			expected: []uint64{3, 2, 4},
+		},
+		{
+			name: "resume message twice",
+			connect: func(hub *Hub, client *Client) {
+				hub.register <- client
+				hub.handleSubscription(client, subscribe)
+				hub.resume(client, models.ResumePayload{LastSequence: 0})
+			},
+			resume:   &models.ResumePayload{LastSequence: 0},
+			expected: []uint64{3, 1, 2, 4},
+		},
+		{
+			name: "resume on the URL",
+			connect: func(hub *Hub, client *Client) {
+				client.topics = []string{PostsTopic}
+				client.resumeFrom = &models.ResumePayload{LastSequence: 1, Epoch: hub.id}
+				hub.register <- client
+				hub.handleSubscription(client, subscribe) // Hub handles one request at a time, so he is registered
+			},
+			expected: []uint64{2, 3, 4},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hub, err := NewHub(&HubConfig{ReplayBufferSize: 16, SendBufferSize: 16})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, stop := context.WithCancel(context.Background())
+			defer stop()
+			go hub.Run(ctx)
+
+			hub.Publish(PostsTopic, models.WebsocketMessage{Type: "post"})
+			hub.Publish(PostsTopic, models.WebsocketMessage{Type: "post"})
+
+			client := newClient(hub, "client", &models.AppClaims{UserId: "user"}, JSONCodec{}, "test")
+			test.connect(hub, client)
+			if test.resume != nil {
+				from := *test.resume
+				if from.LastSequence != 0 {
+					from.Epoch = hub.id // Sequences are only valid with the epoch of the hub
+				}
+				hub.resume(client, from)
+			}
+			hub.Publish(PostsTopic, models.WebsocketMessage{Type: "post"})
+
+			sequences := queuedSequences(t, client)
+			received := make(map[uint64]bool)
+			for _, sequence := range sequences {
+				if received[sequence] {
+					t.Fatalf("event %d received twice: %v", sequence, sequences)
+				}
+				received[sequence] = true
+			}
+			if len(sequences) != len(test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, sequences)
+			}
+			for i := range sequences {
+				if sequences[i] != test.expected[i] {
+					t.Fatalf("expected %v, got %v", test.expected, sequences)
+				}
+			}
+		})
+	}
+}
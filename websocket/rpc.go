@@ -0,0 +1,163 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"hajduksanchez.com/go/rest-websockets/models"
+)
+
+// Type of the messages carrying JSON-RPC 2.0 requests and responses, payload is a request or a batch of them
+const RPCMessage string = "rpc"
+
+const rpcVersion string = "2.0"
+
+// JSON-RPC 2.0 error codes
+const (
+	RPCParseError     int = -32700
+	RPCInvalidRequest int = -32600
+	RPCMethodNotFound int = -32601
+	RPCInvalidParams  int = -32602
+	RPCInternalError  int = -32603
+	RPCUnauthorized   int = -32001 // Token used to open the connection expired or was revoked
+	RPCNotFound       int = -32002 // Resource asked does not exist
+)
+
+// Function in charge of a JSON-RPC method, called with the client that sent the request so it can use his claims
+type RPCMethod func(ctx context.Context, client *Client, params json.RawMessage) (interface{}, *models.RPCError)
+
+// Create an error to return from a method
+func NewRPCError(code int, message string) *models.RPCError {
+	return &models.RPCError{Code: code, Message: message}
+}
+
+// Register method callable by clients through 'rpc' messages
+func (hub *Hub) HandleRPC(method string, handler RPCMethod) {
+	hub.handlersMutex.Lock()
+	defer hub.handlersMutex.Unlock()
+
+	hub.rpcMethods[method] = handler
+}
+
+// Get method registered with the name specified
+func (hub *Hub) rpcMethod(method string) (RPCMethod, bool) {
+	hub.handlersMutex.RLock()
+	defer hub.handlersMutex.RUnlock()
+
+	handler, ok := hub.rpcMethods[method]
+	return handler, ok
+}
+
+// Handle 'rpc' messages with a single request or a batch of them, sending back the responses
+func (hub *Hub) handleRPC(client *Client, message models.WebsocketMessage) {
+	data, err := json.Marshal(message.Payload)
+	if err != nil {
+		client.Send(rpcResponseMessage(rpcErrorResponse(nil, RPCParseError, "parse error")))
+		return
+	}
+
+	// Batch of requests, responses are sent together
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var requests []json.RawMessage
+		if err := json.Unmarshal(trimmed, &requests); err != nil || len(requests) == 0 {
+			client.Send(rpcResponseMessage(rpcErrorResponse(nil, RPCInvalidRequest, "invalid request")))
+			return
+		}
+
+		responses := make([]*models.RPCResponse, 0, len(requests))
+		for _, request := range requests {
+			if response := hub.callRPC(client, request); response != nil {
+				responses = append(responses, response)
+			}
+		}
+		if len(responses) > 0 {
+			client.Send(rpcResponseMessage(responses))
+		}
+		return
+	}
+
+	if response := hub.callRPC(client, data); response != nil {
+		client.Send(rpcResponseMessage(response))
+	}
+}
+
+// Call method of the request, nil response if the request is a notification
+func (hub *Hub) callRPC(client *Client, data json.RawMessage) *models.RPCResponse {
+	var request models.RPCRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		return rpcErrorResponse(nil, RPCInvalidRequest, "invalid request")
+	}
+	id, ok := decodeRPCId(request.Id)
+	if !ok {
+		return rpcErrorResponse(nil, RPCInvalidRequest, "invalid request id")
+	}
+	if request.JSONRPC != rpcVersion || request.Method == "" {
+		return rpcErrorResponse(id, RPCInvalidRequest, "invalid request")
+	}
+
+	result, rpcErr := hub.execute(client, request)
+	if request.Id == nil {
+		return nil // Notifications never receive response, not even errors
+	}
+	if rpcErr != nil {
+		return &models.RPCResponse{JSONRPC: rpcVersion, Error: rpcErr, Id: id}
+	}
+	return &models.RPCResponse{JSONRPC: rpcVersion, Result: result, Id: id}
+}
+
+// Id of the request as a string, an integer, a float or nil, so every codec sends it back with the same
+// type. False if it is not one of them
+func decodeRPCId(data json.RawMessage) (interface{}, bool) {
+	if data == nil {
+		return nil, true // Notification
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var id interface{}
+	if err := decoder.Decode(&id); err != nil {
+		return nil, false
+	}
+	switch value := id.(type) {
+	case nil, string:
+		return value, true
+	case json.Number:
+		if integer, err := value.Int64(); err == nil {
+			return integer, true
+		}
+		float, err := value.Float64()
+		return float, err == nil
+	default:
+		return nil, false // Objects, arrays and booleans are not valid ids
+	}
+}
+
+// Run method of the request if the client is still authorized
+func (hub *Hub) execute(client *Client, request models.RPCRequest) (interface{}, *models.RPCError) {
+	method, ok := hub.rpcMethod(request.Method)
+	if !ok {
+		return nil, NewRPCError(RPCMethodNotFound, "method not found")
+	}
+	// Connection lives longer than his token, so it is validated on every call
+	if err := client.Claims().Valid(); err != nil {
+		return nil, NewRPCError(RPCUnauthorized, err.Error())
+	}
+	if err := hub.checkRevoked(client); err != nil {
+		return nil, NewRPCError(RPCUnauthorized, err.Error())
+	}
+	return method(client.ctx, client, request.Params)
+}
+
+// Response with an error, id is nil if the request was not valid
+func rpcErrorResponse(id interface{}, code int, message string) *models.RPCResponse {
+	return &models.RPCResponse{JSONRPC: rpcVersion, Error: NewRPCError(code, message), Id: id}
+}
+
+// Message to send responses back to the client
+func rpcResponseMessage(payload interface{}) models.WebsocketMessage {
+	return models.WebsocketMessage{
+		Type:    RPCMessage,
+		Payload: payload,
+	}
+}
@@ -0,0 +1,100 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"hajduksanchez.com/go/rest-websockets/models"
+)
+
+// Response as the client reads it, id kept as JSON to compare it whatever the codec decoded
+type rpcTestResponse struct {
+	Result interface{}      `json:"result"`
+	Error  *models.RPCError `json:"error"`
+	Id     json.RawMessage  `json:"id"`
+}
+
+// Every codec sends back the id with the type the client used, so responses can be matched with requests
+func TestRPCThroughCodecs(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  map[string]interface{} // Request as the client encodes it
+		response bool                   // Client expects a response
+		id       string                 // Id of the response as JSON
+		code     int                    // Code of the error, 0 if the call succeeds
+	}{
+		{name: "integer id", request: map[string]interface{}{"id": 7}, response: true, id: "7"},
+		{name: "big integer id", request: map[string]interface{}{"id": int64(1) << 40}, response: true, id: "1099511627776"},
+		{name: "float id", request: map[string]interface{}{"id": 1.5}, response: true, id: "1.5"},
+		{name: "string id", request: map[string]interface{}{"id": "request-1"}, response: true, id: `"request-1"`},
+		{name: "null id", request: map[string]interface{}{"id": nil}, response: true, id: "null"},
+		{name: "notification", request: map[string]interface{}{}, response: false},
+		{name: "object id", request: map[string]interface{}{"id": map[string]interface{}{"a": 1}}, response: true, id: "null", code: RPCInvalidRequest},
+		{name: "boolean id", request: map[string]interface{}{"id": true}, response: true, id: "null", code: RPCInvalidRequest},
+		{name: "unknown method", request: map[string]interface{}{"id": 3, "method": "unknown"}, response: true, id: "3", code: RPCMethodNotFound},
+	}
+
+	hub, err := NewHub(&HubConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub.HandleRPC("echo", func(ctx context.Context, client *Client, params json.RawMessage) (interface{}, *models.RPCError) {
+		return "pong", nil
+	})
+
+	for _, codec := range codecs {
+		for _, test := range tests {
+			t.Run(codec.Name()+" "+test.name, func(t *testing.T) {
+				client := newClient(hub, "client", &models.AppClaims{UserId: "user"}, codec, "test")
+
+				request := map[string]interface{}{"jsonrpc": rpcVersion, "method": "echo"}
+				for key, value := range test.request {
+					request[key] = value
+				}
+				data, err := codec.Marshal(models.WebsocketMessage{Type: RPCMessage, Payload: request})
+				if err != nil {
+					t.Fatal(err)
+				}
+				var message models.WebsocketMessage
+				if err := codec.Unmarshal(data, &message); err != nil {
+					t.Fatal(err)
+				}
+				hub.handleRPC(client, message)
+
+				select {
+				case data = <-client.outbound:
+				default:
+					if test.response {
+						t.Fatal("expected a response")
+					}
+					return
+				}
+				if !test.response {
+					t.Fatal("expected no response for a notification")
+				}
+
+				var reply models.WebsocketMessage
+				if err := codec.Unmarshal(data, &reply); err != nil {
+					t.Fatal(err)
+				}
+				var response rpcTestResponse
+				if err := DecodePayload(reply.Payload, &response); err != nil {
+					t.Fatal(err)
+				}
+				if string(response.Id) != test.id {
+					t.Fatalf("expected id %s, got %s", test.id, response.Id)
+				}
+				if test.code != 0 {
+					if response.Error == nil || response.Error.Code != test.code {
+						t.Fatalf("expected error %d, got %+v", test.code, response.Error)
+					}
+					return
+				}
+				if response.Error != nil || response.Result != "pong" {
+					t.Fatalf("expected result, got %+v", response)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package websocket
+
+import (
+	"hash/fnv"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"hajduksanchez.com/go/rest-websockets/models"
+)
+
+// Part of the clients of the hub, so workers deliver each event to the clients of different shards in
+// parallel. Connections and subscriptions are still handled one at a time by the hub loop: connecting waits
+// for the event being delivered to every shard, subscribing only for the delivery to his own shard
+type shard struct {
+	clients map[string]*Client          // Clients of the shard by connection id
+	topics  map[string]map[*Client]bool // Clients of the shard subscribed to each topic
+	users   map[string]map[*Client]bool // Connections of each user on the shard
+	mutex   *sync.RWMutex               // Written on connections and subscriptions, read on deliveries
+}
+
+func newShard() *shard {
+	return &shard{
+		clients: make(map[string]*Client),
+		topics:  make(map[string]map[*Client]bool),
+		users:   make(map[string]map[*Client]bool),
+		mutex:   &sync.RWMutex{},
+	}
+}
+
+// Shard in charge of the client, always the same one for the same connection id
+func (hub *Hub) shardOf(client *Client) *shard {
+	hash := fnv.New32a()
+	hash.Write([]byte(client.id))
+	return hub.shards[hash.Sum32()%uint32(len(hub.shards))]
+}
+
+// Add client to the shard
+func (shard *shard) add(client *Client) {
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	shard.clients[client.id] = client
+	addToSet(shard.users, client.UserId(), client)
+	for _, topic := range client.topics {
+		shard.subscribe(client, topic)
+	}
+}
+
+// Remove client from the shard and his topics, false if he was not registered
+func (shard *shard) remove(client *Client) bool {
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	if _, ok := shard.clients[client.id]; !ok {
+		return false
+	}
+	delete(shard.clients, client.id)
+	removeFromSet(shard.users, client.UserId(), client)
+	for topic := range client.subscriptions {
+		removeFromSet(shard.topics, topic, client)
+	}
+	return true
+}
+
+// Remove every client from the shard and return them
+func (shard *shard) removeAll() []*Client {
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	clients := make([]*Client, 0, len(shard.clients))
+	for _, client := range shard.clients {
+		clients = append(clients, client)
+	}
+	shard.clients = make(map[string]*Client)
+	shard.topics = make(map[string]map[*Client]bool)
+	shard.users = make(map[string]map[*Client]bool)
+	return clients
+}
+
+// Add client to the list of subscribers of a topic, shard must be locked
+func (shard *shard) subscribe(client *Client, topic string) {
+	addToSet(shard.topics, topic, client)
+	client.subscriptions[topic] = true
+}
+
+// Remove client from the list of subscribers of a topic, shard must be locked
+func (shard *shard) unsubscribe(client *Client, topic string) {
+	removeFromSet(shard.topics, topic, client)
+	delete(client.subscriptions, topic)
+}
+
+// Know if the client should receive the event, shard must be locked
+func (shard *shard) shouldReceive(client *Client, e event) bool {
+	switch e.Kind {
+	case topicEvent:
+		return shard.topics[e.Target][client]
+	case userEvent:
+		return client.UserId() == e.Target
+	default:
+		return true
+	}
+}
+
+// Send the event to the clients of the shard that should receive it, returns how many received it
+func (shard *shard) deliver(e event, ignoreClient *Client, encoded *encodings) int {
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+
+	// Only look at the clients interested in the event
+	var recipients map[*Client]bool
+	switch e.Kind {
+	case topicEvent:
+		recipients = shard.topics[e.Target]
+	case userEvent:
+		recipients = shard.users[e.Target]
+	}
+
+	delivered := 0
+	send := func(client *Client) {
+		if client == ignoreClient {
+			return
+		}
+		data, err := encoded.get(client.codec)
+		if err != nil {
+			return
+		}
+		client.send(data) // Send message to outbound channel to send message to each client
+		if e.Message.Sequence != 0 {
+			client.lastSequence = e.Message.Sequence // Hub is locked while delivering stored events
+		}
+		delivered++
+	}
+	if e.Kind == broadcastEvent {
+		for _, client := range shard.clients {
+			send(client)
+		}
+		return delivered
+	}
+	for client := range recipients {
+		send(client)
+	}
+	return delivered
+}
+
+// Work to deliver an event to the clients of a shard
+type delivery struct {
+	shard     *shard
+	event     event
+	ignore    *Client
+	encoded   *encodings
+	delivered *atomic.Int64   // Clients that received the event on every shard
+	wg        *sync.WaitGroup // Done once the shard delivered the event
+}
+
+// Deliver events to the shards, workers are shared by every shard and live as long as the process
+func (hub *Hub) work() {
+	for d := range hub.deliveries {
+		d.delivered.Add(int64(d.shard.deliver(d.event, d.ignore, d.encoded)))
+		d.wg.Done()
+	}
+}
+
+// Message encoded once for each codec, shared by the workers delivering it
+type encodings struct {
+	message models.WebsocketMessage
+	data    map[string][]byte
+	mutex   *sync.Mutex
+}
+
+func newEncodings(message models.WebsocketMessage) *encodings {
+	return &encodings{
+		message: message,
+		data:    make(map[string][]byte),
+		mutex:   &sync.Mutex{},
+	}
+}
+
+// Message encoded with the codec, encoding it if nobody did it before
+func (encoded *encodings) get(codec Codec) ([]byte, error) {
+	encoded.mutex.Lock()
+	defer encoded.mutex.Unlock()
+
+	if data, ok := encoded.data[codec.Name()]; ok {
+		return data, nil
+	}
+	data, err := codec.Marshal(encoded.message)
+	if err != nil {
+		log.Println("Error encoding message", encoded.message.Type, "as", codec.Name(), err)
+		return nil, err
+	}
+	encoded.data[codec.Name()] = data
+	return data, nil
+}
+
+// Add client to the set of the key specified
+func addToSet(sets map[string]map[*Client]bool, key string, client *Client) {
+	set, ok := sets[key]
+	if !ok {
+		set = make(map[*Client]bool)
+		sets[key] = set
+	}
+	set[client] = true
+}
+
+// Remove client from the set of the key specified, removing the set once it is empty
+func removeFromSet(sets map[string]map[*Client]bool, key string, client *Client) {
+	set, ok := sets[key]
+	if !ok {
+		return
+	}
+	delete(set, client)
+	if len(set) == 0 {
+		delete(sets, key)
+	}
+}
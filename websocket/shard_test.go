@@ -0,0 +1,132 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"hajduksanchez.com/go/rest-websockets/models"
+)
+
+// Clients connected on every shard of the hub
+func connectedClients(hub *Hub) int {
+	count := 0
+	for _, shard := range hub.shards {
+		shard.mutex.RLock()
+		count += len(shard.clients)
+		shard.mutex.RUnlock()
+	}
+	return count
+}
+
+// Register, subscribe, unsubscribe and unregister thousands of clients spread on every shard while events
+// are delivered to them. Run it with 'go test -race' to check shards and workers do not race
+func TestShardsUnderLoad(t *testing.T) {
+	const (
+		clients = 10000
+		users   = 100
+		workers = 16
+		rounds  = 200 // Events of each kind, spread while clients connect
+	)
+
+	if testing.Short() {
+		t.Skip("connects thousands of clients")
+	}
+
+	log.SetOutput(io.Discard) // Every connection is logged
+	defer log.SetOutput(os.Stderr)
+
+	hub, err := NewHub(&HubConfig{SendBufferSize: 4, Shards: 32, Workers: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go hub.Run(ctx)
+
+	all := make([]*Client, clients)
+	for i := range all {
+		claims := &models.AppClaims{UserId: fmt.Sprintf("user-%d", i%users)}
+		all[i] = newClient(hub, fmt.Sprintf("client-%d", i), claims, JSONCodec{}, "test")
+	}
+
+	// Deliver events of every kind while clients connect
+	stopEvents := make(chan struct{})
+	events := &sync.WaitGroup{}
+	events.Add(1)
+	go func() {
+		defer events.Done()
+		for i := 0; i < rounds; i++ {
+			select {
+			case <-stopEvents:
+				return
+			default:
+			}
+			hub.Broadcast(models.WebsocketMessage{Type: "broadcast"}, nil)
+			hub.Publish(PostsTopic, models.WebsocketMessage{Type: "post"})
+			hub.SendToUser(fmt.Sprintf("user-%d", i%users), models.WebsocketMessage{Type: "user"})
+			time.Sleep(10 * time.Millisecond) // Leave room for connections, every delivery locks the hub
+		}
+	}()
+
+	// Each worker connects his clients, and odd ones leave after changing their subscriptions
+	subscribe := models.WebsocketMessage{Type: SubscribeMessage, Payload: models.SubscriptionPayload{Topic: PostsTopic}}
+	unsubscribe := models.WebsocketMessage{Type: UnsubscribeMessage, Payload: models.SubscriptionPayload{Topic: PostsTopic}}
+	connections := &sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		connections.Add(1)
+		go func(w int) {
+			defer connections.Done()
+			for i := w; i < clients; i += workers {
+				client := all[i]
+				if limitErr := hub.reserveConnection(client.UserId(), client.address); limitErr != nil {
+					t.Error(limitErr)
+					return
+				}
+				hub.register <- client
+				hub.handleSubscription(client, subscribe)
+				if i%2 == 1 {
+					hub.handleSubscription(client, unsubscribe)
+					hub.unregister <- client
+				}
+			}
+		}(w)
+	}
+	connections.Wait()
+	close(stopEvents)
+	events.Wait()
+	hub.handleSubscription(all[0], subscribe) // Hub handles one request at a time, so the last unregister already finished
+
+	if connected := connectedClients(hub); connected != clients/2 {
+		t.Fatalf("expected %d clients connected, got %d", clients/2, connected)
+	}
+
+	// Clients that left must not be on any shard, topic or user anymore
+	for i, client := range all {
+		shard := hub.shardOf(client)
+		shard.mutex.RLock()
+		_, registered := shard.clients[client.id]
+		subscribed := shard.topics[PostsTopic][client]
+		ofUser := shard.users[client.UserId()][client]
+		shard.mutex.RUnlock()
+
+		connected := i%2 == 0
+		if registered != connected || subscribed != connected || ofUser != connected {
+			t.Fatalf("client %d connected %v: registered %v, subscribed %v, of user %v", i, connected, registered, subscribed, ofUser)
+		}
+	}
+
+	// Every client still connected receives the next event
+	if delivered := hub.dispatch(event{Kind: topicEvent, Target: PostsTopic, Message: models.WebsocketMessage{Type: "post"}}, nil); delivered != clients/2 {
+		t.Fatalf("expected %d clients to receive the event, got %d", clients/2, delivered)
+	}
+	// Users of even clients only, because even ids always have even users
+	if online := len(hub.OnlineUsers()); online != users/2 {
+		t.Fatalf("expected %d users online, got %d", users/2, online)
+	}
+}
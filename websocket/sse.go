@@ -0,0 +1,161 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/ksuid"
+	"hajduksanchez.com/go/rest-websockets/models"
+)
+
+// Query parameter to listen topics on event streams like '/events?topic=posts&topic=post:<id>'
+const TopicQueryParameter string = "topic"
+
+// Header sent by browsers when they reconnect, with the id of the last event they received
+const lastEventIdHeader string = "Last-Event-ID"
+
+// Stream the same events websocket clients receive as server-sent events, for clients that can not
+// open websockets. Events are always JSON and the token can be sent with the 'token' query parameter
+func (hub *Hub) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	tokenString, _, err := tokenFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	claims, err := hub.config.Authenticate(r.Context(), tokenString)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// Generate an unique ID for this connection, the same user can have many of them
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	client := newClient(hub, id.String(), claims, JSONCodec{}, r.RemoteAddr)
+
+	// Topics can not change later, the client opens a new stream instead
+	client.topics = r.URL.Query()[TopicQueryParameter]
+	for _, topic := range client.topics {
+		if !canSubscribe(client.UserId(), topic) {
+			http.Error(w, "not allowed to subscribe to "+topic, http.StatusForbidden)
+			return
+		}
+	}
+
+	// Browser reconnected, send him the events he missed
+	if lastEventId := r.Header.Get(lastEventIdHeader); lastEventId != "" {
+		from, err := parseEventId(lastEventId)
+		if err != nil {
+			http.Error(w, "invalid "+lastEventIdHeader, http.StatusBadRequest)
+			return
+		}
+		client.resumeFrom = from
+	}
+
+	client.ip = hub.clientAddress(r)
+	if limitErr := hub.reserveConnection(client.UserId(), client.ip); limitErr != nil {
+		log.Println("Rejected event stream of user", client.UserId(), "from", client.ip, limitErr)
+		rejectedConnections.Add(1)
+		http.Error(w, limitErr.reason, limitErr.status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Proxies must not wait for the response to end
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	select {
+	case hub.register <- client: // Send Client to register channel
+	case <-hub.done:
+		hub.releaseConnection(client.UserId(), client.ip)
+		return // Hub stopped, server is shutting down
+	}
+	hub.stream(client, w, flusher, r)
+}
+
+// Write messages to the event stream until the client leaves, is kicked or the hub closes it
+func (hub *Hub) stream(client *Client, w http.ResponseWriter, flusher http.Flusher, r *http.Request) {
+	ticker := time.NewTicker(hub.config.PingPeriod)
+
+	defer func() {
+		ticker.Stop()
+		client.cancel()
+		close(client.stopped)
+		select {
+		case hub.unregister <- client:
+		case <-hub.done: // Hub stopped and already closed every client
+		}
+	}()
+
+	for {
+		select {
+		case message, ok := <-client.outbound:
+			if !ok {
+				return // Queued messages were sent
+			}
+			if err := writeEvent(w, message); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-ticker.C:
+			// Comments are ignored by browsers but keep proxies from closing idle connections
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return // Client went away
+		case <-client.ctx.Done():
+			return // Client was kicked
+		}
+	}
+}
+
+// Write a JSON encoded message as an event, using his epoch and sequence as event id like '<epoch>:<sequence>'
+// so browsers can resume
+func writeEvent(w http.ResponseWriter, data []byte) error {
+	var message struct {
+		Sequence uint64 `json:"sequence"`
+		Epoch    string `json:"epoch"`
+	}
+	if err := json.Unmarshal(data, &message); err == nil && message.Sequence > 0 {
+		if _, err := fmt.Fprintf(w, "id: %s:%d\n", message.Epoch, message.Sequence); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
+
+// Epoch and sequence of an event id written by writeEvent. Ids without epoch are accepted, but
+// they always resync because they can not be compared with our sequences
+func parseEventId(id string) (*models.ResumePayload, error) {
+	from := &models.ResumePayload{}
+	sequence := id
+	if separator := strings.LastIndex(id, ":"); separator >= 0 {
+		from.Epoch = id[:separator]
+		sequence = id[separator+1:]
+	}
+	lastSequence, err := strconv.ParseUint(sequence, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	from.LastSequence = lastSequence
+	return from, nil
+}
@@ -0,0 +1,21 @@
+package websocket
+
+// Topic every client can subscribe to in order to receive post events
+const PostsTopic string = "posts"
+
+// Topic to receive events related to a specific user
+func UserTopic(userId string) string {
+	return "user:" + userId
+}
+
+// Topic to receive events related to a specific post
+func PostTopic(postId string) string {
+	return "post:" + postId
+}
+
+// Relation between a client and a topic to subscribe or unsubscribe
+type subscription struct {
+	client *Client       // Client asking for the subscription
+	topic  string        // Name of the topic like 'posts' or 'post:<id>'
+	done   chan struct{} // Closed once the hub handled it
+}
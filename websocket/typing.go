@@ -0,0 +1,112 @@
+package websocket
+
+import (
+	"time"
+
+	"hajduksanchez.com/go/rest-websockets/models"
+)
+
+// Types of ephemeral messages to tell subscribers of a post that a user is typing a comment,
+// clients send them with the post id and subscribers receive them with the user id too
+const (
+	TypingMessage        string = "typing"
+	TypingStoppedMessage string = "typing-stopped"
+)
+
+// Typing state of a client on a post
+type typing struct {
+	last    time.Time   // Last typing message sent by the client
+	relayed time.Time   // Last time subscribers were told the client is typing
+	expiry  *time.Timer // Tells subscribers the client stopped typing if he does not type again
+}
+
+// Handle 'typing' and 'typing-stopped' messages, relaying them to the other subscribers of the post
+func (hub *Hub) handleTyping(client *Client, message models.WebsocketMessage) {
+	var payload models.TypingPayload
+	if err := DecodePayload(message.Payload, &payload); err != nil || payload.PostId == "" {
+		client.SendError("invalid typing")
+		return
+	}
+
+	if message.Type == TypingStoppedMessage {
+		if client.stopTyping(payload.PostId, nil) {
+			hub.relayTyping(client, TypingStoppedMessage, payload.PostId)
+		}
+		return
+	}
+	// Clients send it on every key stroke, subscribers only need to know it from time to time
+	if client.startTyping(payload.PostId) {
+		hub.relayTyping(client, TypingMessage, payload.PostId)
+	}
+}
+
+// Tell the other subscribers of the post that the client is typing or stopped
+func (hub *Hub) relayTyping(client *Client, messageType string, postId string) {
+	hub.Relay(PostTopic(postId), models.WebsocketMessage{
+		Type: messageType,
+		Payload: models.TypingPayload{
+			PostId: postId,
+			UserId: client.UserId(),
+		},
+	}, client)
+}
+
+// Mark the client as typing on the post, true if subscribers must be told again
+func (client *Client) startTyping(postId string) bool {
+	client.typingMutex.Lock()
+	defer client.typingMutex.Unlock()
+
+	config := client.hub.config
+	now := time.Now()
+	state, ok := client.typing[postId]
+	if !ok {
+		state = &typing{}
+		state.expiry = time.AfterFunc(config.TypingTimeout, func() {
+			if client.stopTyping(postId, state) {
+				client.hub.relayTyping(client, TypingStoppedMessage, postId)
+			}
+		})
+		client.typing[postId] = state
+	} else {
+		state.expiry.Reset(config.TypingTimeout)
+	}
+	state.last = now
+
+	if now.Sub(state.relayed) < config.TypingThrottle {
+		return false
+	}
+	state.relayed = now
+	return true
+}
+
+// Forget the client was typing on the post, true if he was. When it expires, only the state
+// specified is forgotten and only if the client did not type again in the meantime
+func (client *Client) stopTyping(postId string, expired *typing) bool {
+	client.typingMutex.Lock()
+	defer client.typingMutex.Unlock()
+
+	state, ok := client.typing[postId]
+	if !ok {
+		return false
+	}
+	if expired != nil && (state != expired || time.Since(state.last) < client.hub.config.TypingTimeout) {
+		return false // Timer was reset, it runs again later
+	}
+	state.expiry.Stop()
+	delete(client.typing, postId)
+	return true
+}
+
+// Forget every post the client was typing on and return them
+func (client *Client) stopTypingAll() []string {
+	client.typingMutex.Lock()
+	defer client.typingMutex.Unlock()
+
+	posts := make([]string, 0, len(client.typing))
+	for postId, state := range client.typing {
+		state.expiry.Stop()
+		posts = append(posts, postId)
+	}
+	client.typing = make(map[string]*typing)
+	return posts
+}